@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
 	"time"
 
@@ -12,11 +14,17 @@ import (
 func main() {
 	log.Println("debug: start main")
 
+	// ctx bounds only the startup, the app creates its own runtime context in Run
 	ctx, closeCtx := context.WithTimeout(context.Background(), 5*time.Second)
 	defer closeCtx()
 
 	cfg := config.GetConfig()
 
+	if args := flag.Args(); len(args) > 0 {
+		runCommand(ctx, cfg, args)
+		return
+	}
+
 	app, err := app.NewApp(ctx, cfg)
 	if err != nil {
 		log.Fatalf("Create app error: %s", err)
@@ -25,3 +33,40 @@ func main() {
 
 	app.Run()
 }
+
+// runCommand handles subcommands given after the flags, e.g. "gophermart -d <uri> migrate up".
+func runCommand(ctx context.Context, cfg *config.Config, args []string) {
+	switch args[0] {
+	case "migrate":
+		if len(args) != 2 {
+			log.Fatalf("usage: gophermart [flags] migrate up|down|status")
+		}
+
+		// migrations run without the startup timeout, rewriting a big table may take longer
+		report, err := app.Migrate(context.Background(), cfg, args[1])
+		if err != nil {
+			log.Fatalf("Migrate error: %s", err)
+		}
+		fmt.Print(report)
+	case "password-reset":
+		if len(args) != 2 {
+			log.Fatalf("usage: gophermart [flags] password-reset <login>")
+		}
+
+		if err := app.RequestPasswordReset(ctx, cfg, args[1]); err != nil {
+			log.Fatalf("Password reset error: %s", err)
+		}
+		fmt.Printf("password reset token of %s is sent\n", args[1])
+	case "role":
+		if len(args) != 4 || (args[1] != "grant" && args[1] != "revoke") {
+			log.Fatalf("usage: gophermart [flags] role grant|revoke <login> <role>")
+		}
+
+		if err := app.SetUserRole(ctx, cfg, args[2], args[3], args[1] == "grant"); err != nil {
+			log.Fatalf("Role error: %s", err)
+		}
+		fmt.Printf("role %s of %s is %sd\n", args[3], args[2], args[1])
+	default:
+		log.Fatalf("unknown command %q", args[0])
+	}
+}
@@ -0,0 +1,24 @@
+package app
+
+import (
+	"context"
+
+	"github.com/IgorAleksandroff/gophermart/internal/config"
+	"github.com/IgorAleksandroff/gophermart/internal/repository"
+	"github.com/IgorAleksandroff/gophermart/internal/usecase"
+	"github.com/IgorAleksandroff/gophermart/pkg/logger"
+)
+
+// SetUserRole runs the "gophermart role grant|revoke <login> <role>" subcommand,
+// it's the way to appoint the first admin.
+func SetUserRole(ctx context.Context, cfg *config.Config, login, role string, granted bool) error {
+	if cfg.App.DataBaseURI == "" {
+		return ErrEmptyDataBaseURI
+	}
+
+	l := logger.New(cfg.App.LogLevel)
+	repo := repository.NewPGRepository(ctx, l, cfg.App.DataBaseURI)
+	defer repo.Close()
+
+	return usecase.NewAdmin(repo).SetRole(ctx, login, role, granted)
+}
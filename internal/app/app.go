@@ -6,25 +6,33 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/IgorAleksandroff/gophermart/internal/config"
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
 	"github.com/IgorAleksandroff/gophermart/internal/hendler"
+	"github.com/IgorAleksandroff/gophermart/internal/notifier"
 	"github.com/IgorAleksandroff/gophermart/internal/repository"
 	"github.com/IgorAleksandroff/gophermart/internal/usecase"
 	"github.com/IgorAleksandroff/gophermart/internal/webapi"
 	"github.com/IgorAleksandroff/gophermart/internal/worker"
+	"github.com/IgorAleksandroff/gophermart/pkg/breached"
+	"github.com/IgorAleksandroff/gophermart/pkg/hasher"
 	"github.com/IgorAleksandroff/gophermart/pkg/httpserver"
+	"github.com/IgorAleksandroff/gophermart/pkg/jwtkeys"
 	"github.com/IgorAleksandroff/gophermart/pkg/logger"
 	"github.com/go-chi/chi"
 )
 
 type app struct {
-	cfg    *config.Config
-	router http.Handler
-	worker *worker.Updater
-	l      *logger.Logger
-	Cancel cancelFunc
+	cfg        *config.Config
+	router     http.Handler
+	worker     *worker.Updater
+	cleaner    *worker.Cleaner
+	reconciler *worker.Reconciler
+	l          *logger.Logger
+	Cancel     cancelFunc
 }
 
 type cancelFunc func()
@@ -38,65 +46,281 @@ func NewApp(ctx context.Context, cfg *config.Config) (*app, error) {
 	var repo usecase.OrdersRepository
 	var authRepo usecase.UserRepository
 	var statusesRepo usecase.StatusesRepository
+	var resetRepo usecase.PasswordResetRepository
+	var loginAttemptsRepo usecase.LoginAttemptsRepository
+	var adminRepo usecase.AdminRepository
+	var apiKeysRepo usecase.APIKeysRepository
+	var ledgerAuditRepo usecase.LedgerAuditRepository
 	if cfg.App.DataBaseURI != "" {
 		pgRepo := repository.NewPGRepository(ctx, l, cfg.App.DataBaseURI)
 		repo, authRepo, statusesRepo = pgRepo, pgRepo, pgRepo
+		resetRepo, loginAttemptsRepo, adminRepo, apiKeysRepo = pgRepo, pgRepo, pgRepo, pgRepo
+		ledgerAuditRepo = pgRepo
 	} else {
 		inMemoRepo := repository.NewMemoRepository(ctx, l)
 		repo, authRepo, statusesRepo = inMemoRepo, inMemoRepo, inMemoRepo
+		resetRepo, loginAttemptsRepo, adminRepo, apiKeysRepo = inMemoRepo, inMemoRepo, inMemoRepo, inMemoRepo
+		ledgerAuditRepo = inMemoRepo
 	}
 
-	apiClient := webapi.NewClient(cfg.App.AccrualSystemAddress)
+	apiClient := webapi.NewAccrualClient(cfg.App.AccrualSystemAddress)
 	ordersUsecase := usecase.NewOrders(repo, apiClient)
-	auth := usecase.NewAuthorization(authRepo)
-	statusesUsecase := usecase.NewStatuses(ordersUsecase, statusesRepo)
+	passwordHasher, err := hasher.New(cfg.Auth.PasswordHashAlgorithm, hasher.NewLegacySHA1(usecase.LegacySalt))
+	if err != nil {
+		return nil, fmt.Errorf("app - NewApp - hasher.New: %w", err)
+	}
+	credentialsPolicy, err := newCredentialsPolicy(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("app - NewApp - newCredentialsPolicy: %w", err)
+	}
+	tokenKeys, err := loadTokenKeys(cfg, l)
+	if err != nil {
+		return nil, fmt.Errorf("app - NewApp - loadTokenKeys: %w", err)
+	}
+	auth := usecase.NewAuthorization(
+		authRepo,
+		passwordHasher,
+		credentialsPolicy,
+		tokenKeys,
+		cfg.Auth.TokenTTL,
+		cfg.Auth.RefreshTokenTTL,
+		l,
+	)
+	passwordReset := usecase.NewPasswordReset(
+		resetRepo,
+		passwordHasher,
+		credentialsPolicy,
+		newNotifier(cfg, l),
+		cfg.Auth.PasswordResetTTL,
+	)
+	loginGuard := usecase.NewLoginGuard(
+		loginAttemptsRepo,
+		cfg.Auth.LoginMaxAttempts,
+		cfg.Auth.LoginIPMaxAttempts,
+		cfg.Auth.LoginLockout,
+		cfg.Auth.LoginFailuresWindow,
+	)
+	statusesUsecase := usecase.NewStatuses(ordersUsecase, statusesRepo, cfg.Worker.MaxAttempts)
 
-	w := worker.NewUpdater(ctx, statusesUsecase, l)
+	w := worker.NewUpdater(statusesUsecase, cfg.Worker.PoolSize, cfg.Worker.BatchSize, l)
 
-	h := hendler.New(ordersUsecase, auth, l)
+	var handlerOpts []hendler.Option
+	if cfg.Auth.CookieMode {
+		sameSite, err := parseSameSite(cfg.Auth.CookieSameSite)
+		if err != nil {
+			return nil, fmt.Errorf("app - NewApp - parseSameSite: %w", err)
+		}
+		handlerOpts = append(handlerOpts, hendler.CookieMode(!cfg.Auth.CookieInsecure, sameSite, cfg.Auth.RefreshTokenTTL))
+	}
+
+	h := hendler.New(
+		ordersUsecase,
+		auth,
+		passwordReset,
+		loginGuard,
+		usecase.NewAdmin(adminRepo),
+		usecase.NewAPIKeys(apiKeysRepo),
+		tokenKeys,
+		l,
+		handlerOpts...,
+	)
 
 	h.Register(r, http.MethodPost, "/api/user/register", h.HandleUserRegister)
 	h.Register(r, http.MethodPost, "/api/user/login", h.HandleUserLogin)
+	h.Register(r, http.MethodPost, "/api/user/token/refresh", h.HandleTokenRefresh)
+	h.Register(r, http.MethodPost, "/api/user/password/reset", h.HandleResetPassword)
+	h.Register(r, http.MethodGet, "/.well-known/jwks.json", h.HandleGetJWKS)
 
 	r.Group(func(r chi.Router) {
 		r.Use(h.UserIdentity)
 
+		h.Register(r, http.MethodPost, "/api/user/logout", h.HandleLogout)
+		h.Register(r, http.MethodPost, "/api/user/logout-all", h.HandleLogoutAll)
+		h.Register(r, http.MethodPost, "/api/user/password", h.HandleChangePassword)
+
 		h.Register(r, http.MethodPost, "/api/user/orders", h.HandlePostOrders)
+		h.Register(r, http.MethodPost, "/api/user/orders/batch", h.HandlePostOrdersBatch)
 		h.Register(r, http.MethodGet, "/api/user/orders", h.HandleGetOrders)
+		h.Register(r, http.MethodGet, "/api/user/orders/{number}", h.HandleGetOrder)
 
 		h.Register(r, http.MethodGet, "/api/user/balance", h.HandleGetBalance)
 		h.Register(r, http.MethodPost, "/api/user/balance/withdraw", h.HandlePostBalanceWithdraw)
 		h.Register(r, http.MethodGet, "/api/user/withdrawals", h.HandleGetWithdrawals)
+		h.Register(r, http.MethodGet, "/api/user/ledger", h.HandleGetLedger)
+	})
+
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(h.UserIdentity, h.RequireRole(entity.RoleAdmin))
+
+		h.Register(r, http.MethodGet, "/users/{login}", h.HandleAdminGetUser)
+		h.Register(r, http.MethodGet, "/users/{login}/orders", h.HandleAdminGetUserOrders)
+		h.Register(r, http.MethodGet, "/users/{login}/withdrawals", h.HandleAdminGetUserWithdrawals)
+		h.Register(r, http.MethodPost, "/users/{login}/block", h.HandleAdminBlockUser)
+		h.Register(r, http.MethodPost, "/users/{login}/unblock", h.HandleAdminUnblockUser)
+		h.Register(r, http.MethodPost, "/users/{login}/password-reset", h.HandleAdminResetPassword)
+		h.Register(r, http.MethodPost, "/users/{login}/adjustments", h.HandleAdminAdjustBalance)
+
+		h.Register(r, http.MethodPost, "/api-keys", h.HandleAdminCreateAPIKey)
+		h.Register(r, http.MethodGet, "/api-keys", h.HandleAdminGetAPIKeys)
+		h.Register(r, http.MethodDelete, "/api-keys/{id}", h.HandleAdminRevokeAPIKey)
+	})
+
+	// partner services act on behalf of the {login} user with an API key
+	r.Route("/api/partner/users/{login}", func(r chi.Router) {
+		r.Use(h.APIKeyIdentity)
+
+		r.Group(func(r chi.Router) {
+			r.Use(h.RequireScope(entity.ScopeOrdersWrite))
+			h.Register(r, http.MethodPost, "/orders", h.HandlePostOrders)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(h.RequireScope(entity.ScopeOrdersRead))
+			h.Register(r, http.MethodGet, "/orders", h.HandleGetOrders)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(h.RequireScope(entity.ScopeBalanceRead))
+			h.Register(r, http.MethodGet, "/balance", h.HandleGetBalance)
+		})
 	})
 
 	return &app{
-		cfg:    cfg,
-		router: r,
-		worker: w,
-		l:      l,
-		Cancel: repo.Close,
+		cfg:        cfg,
+		router:     r,
+		worker:     w,
+		cleaner:    worker.NewCleaner(auth, l),
+		reconciler: worker.NewReconciler(usecase.NewLedgerAudit(ledgerAuditRepo), l),
+		l:          l,
+		Cancel:     repo.Close,
 	}, nil
 }
 
+// newCredentialsPolicy checks new passwords against the breached passwords file if it's configured,
+// otherwise against the bundled list.
+func newCredentialsPolicy(cfg *config.Config) (usecase.CredentialsPolicy, error) {
+	breachedPasswords := breached.Bundled()
+	if cfg.Auth.BreachedPasswordsFile != "" {
+		var err error
+		if breachedPasswords, err = breached.Load(cfg.Auth.BreachedPasswordsFile); err != nil {
+			return usecase.CredentialsPolicy{}, err
+		}
+	}
+
+	return usecase.NewCredentialsPolicy(
+		cfg.Auth.LoginMinLength,
+		cfg.Auth.LoginMaxLength,
+		cfg.Auth.LoginPattern,
+		cfg.Auth.PasswordMinLength,
+		breachedPasswords,
+	)
+}
+
+func parseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+
+	return 0, fmt.Errorf("unknown cookie SameSite %q, expected strict, lax or none", value)
+}
+
+// newNotifier writes notifications for users to the notifier file if it's configured, otherwise to the log.
+// newNotifier never writes reset tokens to the log unless it's explicitly allowed for development.
+func newNotifier(cfg *config.Config, l *logger.Logger) usecase.Notifier {
+	switch {
+	case cfg.Auth.NotifierFile != "":
+		return notifier.NewFile(cfg.Auth.NotifierFile)
+	case cfg.Auth.NotifierLogTokens:
+		l.Warn("password reset tokens are written to the log, %s is for development only", config.NotifierLogTokensEnv)
+		return notifier.NewLog(l)
+	default:
+		l.Warn("no notifier configured, password reset tokens aren't delivered, set %s", config.NotifierFileEnv)
+		return notifier.NewDiscard(l)
+	}
+}
+
+// loadTokenKeys prefers the keys file, then the secret from env. Without both tokens are signed
+// with a random key, so they don't survive a restart and aren't shared between replicas.
+func loadTokenKeys(cfg *config.Config, l *logger.Logger) (*jwtkeys.KeySet, error) {
+	if cfg.Auth.JWTKeysFile != "" {
+		return jwtkeys.Load(cfg.Auth.JWTKeysFile)
+	}
+
+	if cfg.Auth.JWTSecret != "" {
+		return jwtkeys.FromSecret(cfg.Auth.JWTKeyID, string(cfg.Auth.JWTSecret))
+	}
+
+	l.Warn("no token signing key configured, use a random one")
+	return jwtkeys.Ephemeral()
+}
+
+// Run serves http, updates order statuses and cleans up expired tokens until a stop signal,
+// then shuts all of them down.
 func (a *app) Run() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// start http server
 	httpServer := httpserver.New(a.router, httpserver.Addr(a.cfg.HTTPServer.ServerAddress))
 
 	// start worker for update statuses of orders
-	go a.worker.Run()
+	workerDone := make(chan error, 1)
+	go func() {
+		workerDone <- a.worker.Run(ctx)
+	}()
+
+	// start cleaner of expired revoked tokens
+	cleanerDone := make(chan error, 1)
+	go func() {
+		cleanerDone <- a.cleaner.Run(ctx)
+	}()
+
+	// start reconciler of balances with the ledger
+	reconcilerDone := make(chan error, 1)
+	go func() {
+		reconcilerDone <- a.reconciler.Run(ctx)
+	}()
 
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
+	var workerErr error
+	workerStopped := false
+
 	select {
 	case s := <-interrupt:
 		a.l.Info("app - Run - signal: " + s.String())
 	case err := <-httpServer.Notify():
 		a.l.Error(fmt.Errorf("app - Run - httpServer.Notify: %w", err))
+	case workerErr = <-workerDone:
+		workerStopped = true
+		a.l.Error("app - Run - worker stopped unexpectedly")
 	}
 
+	cancel()
+
 	err := httpServer.Shutdown()
 	if err != nil {
 		a.l.Error(fmt.Errorf("app - Run - httpServer.Shutdown: %w", err))
 	}
+
+	if err = <-cleanerDone; err != nil {
+		a.l.Error(fmt.Errorf("app - Run - cleaner.Run: %w", err))
+	}
+
+	if err = <-reconcilerDone; err != nil {
+		a.l.Error(fmt.Errorf("app - Run - reconciler.Run: %w", err))
+	}
+
+	if !workerStopped {
+		workerErr = <-workerDone
+	}
+	if workerErr != nil {
+		a.l.Error(fmt.Errorf("app - Run - worker.Run: %w", workerErr))
+		return
+	}
+	a.l.Info("app - Run - worker stopped")
 }
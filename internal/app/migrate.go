@@ -0,0 +1,29 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/IgorAleksandroff/gophermart/internal/config"
+	"github.com/IgorAleksandroff/gophermart/internal/migrations"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+var ErrEmptyDataBaseURI = errors.New("the command needs a database uri, set it with -d or DATABASE_URI")
+
+// Migrate runs the "gophermart migrate up|down|status" subcommand and returns its report.
+func Migrate(ctx context.Context, cfg *config.Config, command string) (string, error) {
+	if cfg.App.DataBaseURI == "" {
+		return "", ErrEmptyDataBaseURI
+	}
+
+	db, err := sqlx.ConnectContext(ctx, "postgres", cfg.App.DataBaseURI)
+	if err != nil {
+		return "", fmt.Errorf("app - Migrate - postgres.New: %w", err)
+	}
+	defer db.Close()
+
+	return migrations.Run(ctx, db, command)
+}
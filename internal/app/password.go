@@ -0,0 +1,44 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IgorAleksandroff/gophermart/internal/config"
+	"github.com/IgorAleksandroff/gophermart/internal/repository"
+	"github.com/IgorAleksandroff/gophermart/internal/usecase"
+	"github.com/IgorAleksandroff/gophermart/pkg/hasher"
+	"github.com/IgorAleksandroff/gophermart/pkg/logger"
+)
+
+// RequestPasswordReset runs the "gophermart password-reset <login>" subcommand: it sends the user
+// a reset token through the configured notifier.
+func RequestPasswordReset(ctx context.Context, cfg *config.Config, login string) error {
+	if cfg.App.DataBaseURI == "" {
+		return ErrEmptyDataBaseURI
+	}
+
+	l := logger.New(cfg.App.LogLevel)
+	repo := repository.NewPGRepository(ctx, l, cfg.App.DataBaseURI)
+	defer repo.Close()
+
+	passwordHasher, err := hasher.New(cfg.Auth.PasswordHashAlgorithm, hasher.NewLegacySHA1(usecase.LegacySalt))
+	if err != nil {
+		return fmt.Errorf("app - RequestPasswordReset - hasher.New: %w", err)
+	}
+
+	credentialsPolicy, err := newCredentialsPolicy(cfg)
+	if err != nil {
+		return fmt.Errorf("app - RequestPasswordReset - newCredentialsPolicy: %w", err)
+	}
+
+	passwordReset := usecase.NewPasswordReset(
+		repo,
+		passwordHasher,
+		credentialsPolicy,
+		newNotifier(cfg, l),
+		cfg.Auth.PasswordResetTTL,
+	)
+
+	return passwordReset.RequestReset(ctx, login)
+}
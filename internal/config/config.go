@@ -4,7 +4,9 @@ import (
 	"flag"
 	"log"
 	"os"
+	"strconv"
 	"sync"
+	"time"
 )
 
 const (
@@ -19,12 +21,85 @@ const (
 
 	LogLevelEnv     = "LOG_LEVEL"
 	LogLevelDefault = "Info"
+
+	PasswordHashAlgorithmEnv     = "PASSWORD_HASH_ALGORITHM"
+	PasswordHashAlgorithmDefault = "bcrypt"
+
+	TokenTTLEnv     = "TOKEN_TTL"
+	TokenTTLDefault = 15 * time.Minute
+
+	RefreshTokenTTLEnv     = "REFRESH_TOKEN_TTL"
+	RefreshTokenTTLDefault = 30 * 24 * time.Hour
+
+	JWTKeysFileEnv     = "JWT_KEYS_FILE"
+	JWTKeysFileDefault = ""
+
+	JWTSecretEnv = "JWT_SECRET"
+
+	JWTKeyIDEnv     = "JWT_KEY_ID"
+	JWTKeyIDDefault = "default"
+
+	PasswordResetTTLEnv     = "PASSWORD_RESET_TTL"
+	PasswordResetTTLDefault = time.Hour
+
+	NotifierFileEnv     = "NOTIFIER_FILE"
+	NotifierFileDefault = ""
+
+	NotifierLogTokensEnv     = "NOTIFIER_LOG_TOKENS"
+	NotifierLogTokensDefault = false
+
+	LoginMaxAttemptsEnv     = "LOGIN_MAX_ATTEMPTS"
+	LoginMaxAttemptsDefault = 5
+
+	LoginIPMaxAttemptsEnv     = "LOGIN_IP_MAX_ATTEMPTS"
+	LoginIPMaxAttemptsDefault = 50
+
+	LoginLockoutEnv     = "LOGIN_LOCKOUT"
+	LoginLockoutDefault = time.Minute
+
+	LoginFailuresWindowEnv     = "LOGIN_FAILURES_WINDOW"
+	LoginFailuresWindowDefault = 15 * time.Minute
+
+	LoginMinLengthEnv     = "LOGIN_MIN_LENGTH"
+	LoginMinLengthDefault = 3
+
+	LoginMaxLengthEnv     = "LOGIN_MAX_LENGTH"
+	LoginMaxLengthDefault = 64
+
+	LoginPatternEnv     = "LOGIN_PATTERN"
+	LoginPatternDefault = `^[a-zA-Z0-9._-]+$`
+
+	PasswordMinLengthEnv     = "PASSWORD_MIN_LENGTH"
+	PasswordMinLengthDefault = 8
+
+	BreachedPasswordsFileEnv     = "BREACHED_PASSWORDS_FILE"
+	BreachedPasswordsFileDefault = ""
+
+	CookieModeEnv     = "AUTH_COOKIE_MODE"
+	CookieModeDefault = false
+
+	CookieInsecureEnv     = "AUTH_COOKIE_INSECURE"
+	CookieInsecureDefault = false
+
+	CookieSameSiteEnv     = "AUTH_COOKIE_SAMESITE"
+	CookieSameSiteDefault = "strict"
+
+	WorkerPoolSizeEnv     = "WORKER_POOL_SIZE"
+	WorkerPoolSizeDefault = 4
+
+	WorkerBatchSizeEnv     = "WORKER_BATCH_SIZE"
+	WorkerBatchSizeDefault = 50
+
+	WorkerMaxAttemptsEnv     = "WORKER_MAX_ATTEMPTS"
+	WorkerMaxAttemptsDefault = 20
 )
 
 type (
 	Config struct {
 		App        appConfig
 		HTTPServer serverConfig
+		Worker     workerConfig
+		Auth       authConfig
 	}
 
 	appConfig struct {
@@ -36,8 +111,58 @@ type (
 	serverConfig struct {
 		ServerAddress string
 	}
+
+	authConfig struct {
+		PasswordHashAlgorithm string
+		TokenTTL              time.Duration
+		RefreshTokenTTL       time.Duration
+		// JWTKeysFile has the set of signing keys for rotation, it takes precedence over JWTSecret.
+		JWTKeysFile string
+		JWTSecret   Secret
+		JWTKeyID    string
+		// PasswordResetTTL is how long a password reset token is valid.
+		PasswordResetTTL time.Duration
+		// NotifierFile gets notifications for users as JSON lines. Without it notifications aren't delivered,
+		// unless NotifierLogTokens writes them with the reset tokens to the log, it's for development only.
+		NotifierFile      string
+		NotifierLogTokens bool
+		// LoginMaxAttempts failed logins in a row lock out the login for LoginLockout,
+		// every next failure doubles it. LoginIPMaxAttempts is the same threshold for a client IP.
+		LoginMaxAttempts    int
+		LoginIPMaxAttempts  int
+		LoginLockout        time.Duration
+		LoginFailuresWindow time.Duration
+		// LoginPattern is the allowed charset of new logins as a regular expression.
+		LoginMinLength    int
+		LoginMaxLength    int
+		LoginPattern      string
+		PasswordMinLength int
+		// BreachedPasswordsFile replaces the bundled list of leaked passwords.
+		BreachedPasswordsFile string
+		// CookieMode sets the tokens in HttpOnly cookies for browser clients, CookieInsecure drops
+		// the Secure attribute for local development over http. CookieSameSite is strict, lax or none.
+		CookieMode     bool
+		CookieInsecure bool
+		CookieSameSite string
+	}
+
+	workerConfig struct {
+		PoolSize    int
+		BatchSize   int
+		MaxAttempts int
+	}
 )
 
+// Secret is a config value that is never printed.
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "***"
+}
+
 var instance *Config
 var once sync.Once
 
@@ -49,6 +174,15 @@ func GetConfig() *Config {
 		DBFlag := flag.String("d", DataBaseAddressDefault, "адрес и порт сервера")
 		AccrualFlag := flag.String("r", AccrualSystemAddressDefault, "адрес и порт сервера")
 		LogFlag := flag.String("l", LogLevelDefault, "адрес и порт сервера")
+		PoolSizeFlag := flag.Int("w", WorkerPoolSizeDefault, "количество обработчиков статусов заказов")
+		BatchSizeFlag := flag.Int("b", WorkerBatchSizeDefault, "количество заказов, забираемых на обработку за раз")
+		MaxAttemptsFlag := flag.Int("m", WorkerMaxAttemptsDefault, "количество неудачных опросов заказа до переноса в dead letter")
+		HashAlgorithmFlag := flag.String("p", PasswordHashAlgorithmDefault, "алгоритм хеширования паролей: bcrypt или argon2id")
+		TokenTTLFlag := flag.Duration("t", TokenTTLDefault, "время жизни access-токена")
+		LoginMaxAttemptsFlag := flag.Int("f", LoginMaxAttemptsDefault, "количество неудачных попыток входа до блокировки логина")
+		PasswordMinLengthFlag := flag.Int("s", PasswordMinLengthDefault, "минимальная длина пароля")
+		CookieModeFlag := flag.Bool("c", CookieModeDefault, "передавать токены в cookie для браузерных клиентов")
+		KeysFileFlag := flag.String("k", JWTKeysFileDefault, "файл с ключами подписи токенов")
 		flag.Parse()
 
 		serverCfg := serverConfig{
@@ -61,9 +195,41 @@ func GetConfig() *Config {
 			LogLevel:             getEnvString(LogLevelEnv, *LogFlag),
 		}
 
+		workerCfg := workerConfig{
+			PoolSize:    getEnvInt(WorkerPoolSizeEnv, *PoolSizeFlag),
+			BatchSize:   getEnvInt(WorkerBatchSizeEnv, *BatchSizeFlag),
+			MaxAttempts: getEnvInt(WorkerMaxAttemptsEnv, *MaxAttemptsFlag),
+		}
+
+		authCfg := authConfig{
+			PasswordHashAlgorithm: getEnvString(PasswordHashAlgorithmEnv, *HashAlgorithmFlag),
+			TokenTTL:              getEnvDuration(TokenTTLEnv, *TokenTTLFlag),
+			RefreshTokenTTL:       getEnvDuration(RefreshTokenTTLEnv, RefreshTokenTTLDefault),
+			JWTKeysFile:           getEnvString(JWTKeysFileEnv, *KeysFileFlag),
+			JWTSecret:             Secret(os.Getenv(JWTSecretEnv)),
+			JWTKeyID:              getEnvString(JWTKeyIDEnv, JWTKeyIDDefault),
+			PasswordResetTTL:      getEnvDuration(PasswordResetTTLEnv, PasswordResetTTLDefault),
+			NotifierFile:          getEnvString(NotifierFileEnv, NotifierFileDefault),
+			NotifierLogTokens:     getEnvBool(NotifierLogTokensEnv, NotifierLogTokensDefault),
+			LoginMaxAttempts:      getEnvInt(LoginMaxAttemptsEnv, *LoginMaxAttemptsFlag),
+			LoginIPMaxAttempts:    getEnvInt(LoginIPMaxAttemptsEnv, LoginIPMaxAttemptsDefault),
+			LoginLockout:          getEnvDuration(LoginLockoutEnv, LoginLockoutDefault),
+			LoginFailuresWindow:   getEnvDuration(LoginFailuresWindowEnv, LoginFailuresWindowDefault),
+			LoginMinLength:        getEnvInt(LoginMinLengthEnv, LoginMinLengthDefault),
+			LoginMaxLength:        getEnvInt(LoginMaxLengthEnv, LoginMaxLengthDefault),
+			LoginPattern:          getEnvString(LoginPatternEnv, LoginPatternDefault),
+			PasswordMinLength:     getEnvInt(PasswordMinLengthEnv, *PasswordMinLengthFlag),
+			BreachedPasswordsFile: getEnvString(BreachedPasswordsFileEnv, BreachedPasswordsFileDefault),
+			CookieMode:            getEnvBool(CookieModeEnv, *CookieModeFlag),
+			CookieInsecure:        getEnvBool(CookieInsecureEnv, CookieInsecureDefault),
+			CookieSameSite:        getEnvString(CookieSameSiteEnv, CookieSameSiteDefault),
+		}
+
 		instance = &Config{
 			App:        appCfg,
 			HTTPServer: serverCfg,
+			Worker:     workerCfg,
+			Auth:       authCfg,
 		}
 
 		log.Printf("Parsed config: %+v", instance)
@@ -80,3 +246,48 @@ func getEnvString(envName, defaultValue string) string {
 	}
 	return value
 }
+
+func getEnvInt(envName string, defaultValue int) int {
+	value := os.Getenv(envName)
+	if value == "" {
+		log.Printf("empty env: %s, default: %d", envName, defaultValue)
+		return defaultValue
+	}
+
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("invalid env: %s=%s, default: %d", envName, value, defaultValue)
+		return defaultValue
+	}
+	return intValue
+}
+
+func getEnvBool(envName string, defaultValue bool) bool {
+	value := os.Getenv(envName)
+	if value == "" {
+		log.Printf("empty env: %s, default: %t", envName, defaultValue)
+		return defaultValue
+	}
+
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("invalid env: %s=%s, default: %t", envName, value, defaultValue)
+		return defaultValue
+	}
+	return boolValue
+}
+
+func getEnvDuration(envName string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(envName)
+	if value == "" {
+		log.Printf("empty env: %s, default: %s", envName, defaultValue)
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("invalid env: %s=%s, default: %s", envName, value, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
@@ -0,0 +1,232 @@
+package entity
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AmountDecimals is the number of decimal places of an amount, the same as the DECIMAL(16, 4) columns.
+const AmountDecimals = 4
+
+const (
+	amountScale = 10000
+	// MaxAmount is the largest absolute amount a DECIMAL(16, 4) column holds, in ten-thousandths.
+	MaxAmount Amount = 1e16 - 1
+	// maxAmountExponent bounds the exponent of a JSON number, so "1e1000000" isn't expanded to a megabyte.
+	maxAmountExponent = 32
+)
+
+var (
+	ErrInvalidAmount  = errors.New("invalid amount")
+	ErrAmountOverflow = errors.New("amount overflow")
+)
+
+// Amount is an exact number of points in ten-thousandths, so sums don't pile up the rounding error of float64.
+// It's marshalled to JSON as a plain number, 729.98 rather than "729.98", and stored as a decimal.
+type Amount int64
+
+// ParseAmount parses a decimal number like "-12.5". It returns ErrInvalidAmount for more than
+// AmountDecimals decimal places and ErrAmountOverflow for a number out of MaxAmount.
+func ParseAmount(s string) (Amount, error) {
+	text := s
+	negative := strings.HasPrefix(text, "-")
+	if negative {
+		text = text[1:]
+	}
+
+	integer, fraction, _ := strings.Cut(text, ".")
+	if integer == "" || !isDigits(integer) || !isDigits(fraction) || strings.HasSuffix(text, ".") {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if len(fraction) > AmountDecimals {
+		return 0, fmt.Errorf("%w: %q has more than %d decimal places", ErrInvalidAmount, s, AmountDecimals)
+	}
+
+	units, err := strconv.ParseInt(integer, 10, 64)
+	if err != nil || units > int64(MaxAmount/amountScale) {
+		return 0, fmt.Errorf("%w: %q", ErrAmountOverflow, s)
+	}
+	fraction += strings.Repeat("0", AmountDecimals-len(fraction))
+	fractional, _ := strconv.ParseInt(fraction, 10, 64)
+
+	a := Amount(units*amountScale + fractional)
+	if negative {
+		a = -a
+	}
+
+	return a, nil
+}
+
+// RoundAmount parses a number like ParseAmount, in the exponent form too, and rounds it half away from zero
+// to AmountDecimals decimal places instead of rejecting the longer ones. It's for the numbers of other systems,
+// the points of users are never rounded.
+func RoundAmount(s string) (Amount, error) {
+	text, err := expandExponent(s)
+	if err != nil {
+		return 0, err
+	}
+
+	integer, fraction, _ := strings.Cut(text, ".")
+	if len(fraction) <= AmountDecimals {
+		return ParseAmount(text)
+	}
+	if !isDigits(fraction) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	a, err := ParseAmount(integer + "." + fraction[:AmountDecimals])
+	if err != nil {
+		return 0, err
+	}
+	if fraction[AmountDecimals] < '5' {
+		return a, nil
+	}
+
+	if strings.HasPrefix(text, "-") {
+		return a.Sub(1)
+	}
+	return a.Add(1)
+}
+
+// String formats the amount without trailing zeros, "500" or "729.98".
+func (a Amount) String() string {
+	units, fractional := int64(a)/amountScale, int64(a)%amountScale
+
+	sign := ""
+	if a < 0 {
+		sign, units, fractional = "-", -units, -fractional
+	}
+
+	result := sign + strconv.FormatInt(units, 10)
+	if fractional != 0 {
+		fraction := fmt.Sprintf("%0*d", AmountDecimals, fractional)
+		result += "." + strings.TrimRight(fraction, "0")
+	}
+
+	return result
+}
+
+// Add returns a+b or ErrAmountOverflow when the sum is out of MaxAmount.
+func (a Amount) Add(b Amount) (Amount, error) {
+	sum := a + b
+	if sum > MaxAmount || sum < -MaxAmount || (b > 0 && sum < a) || (b < 0 && sum > a) {
+		return 0, fmt.Errorf("%w: %s + %s", ErrAmountOverflow, a, b)
+	}
+
+	return sum, nil
+}
+
+// Sub returns a-b or ErrAmountOverflow when the difference is out of MaxAmount.
+func (a Amount) Sub(b Amount) (Amount, error) {
+	if b < -MaxAmount || b > MaxAmount {
+		return 0, fmt.Errorf("%w: %s - %s", ErrAmountOverflow, a, b)
+	}
+
+	return a.Add(-b)
+}
+
+// Neg returns -a, it never overflows for amounts within MaxAmount.
+func (a Amount) Neg() Amount {
+	return -a
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number, in the exponent form too if it's exact to AmountDecimals,
+// "1.5e2" but not "1e-5". A null leaves the amount unchanged.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	text, err := expandExponent(string(data))
+	if err != nil {
+		return err
+	}
+
+	parsed, err := ParseAmount(text)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+
+	return nil
+}
+
+// expandExponent rewrites a number in the exponent form as a plain one, "1.5e2" as "150".
+// Exponents over maxAmountExponent can't give a valid amount and are rejected before expanding.
+func expandExponent(s string) (string, error) {
+	mantissa, exponent, found := strings.Cut(strings.ToLower(s), "e")
+	if !found {
+		return s, nil
+	}
+
+	exp, err := strconv.Atoi(exponent)
+	if err != nil || exp > maxAmountExponent || exp < -maxAmountExponent {
+		return "", fmt.Errorf("%w: %q exponent is out of range", ErrInvalidAmount, s)
+	}
+
+	sign := ""
+	if strings.HasPrefix(mantissa, "-") {
+		sign, mantissa = "-", mantissa[1:]
+	}
+	integer, fraction, _ := strings.Cut(mantissa, ".")
+	if integer == "" || !isDigits(integer) || !isDigits(fraction) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	digits, point := integer+fraction, len(integer)+exp
+	switch {
+	case point <= 0:
+		digits, point = strings.Repeat("0", 1-point)+digits, 1
+	case point > len(digits):
+		digits += strings.Repeat("0", point-len(digits))
+	}
+
+	integer, fraction = digits[:point], strings.TrimRight(digits[point:], "0")
+	if fraction == "" {
+		return sign + integer, nil
+	}
+
+	return sign + integer + "." + fraction, nil
+}
+
+// Scan reads a decimal column, lib/pq returns it as text.
+func (a *Amount) Scan(src interface{}) error {
+	var err error
+	switch value := src.(type) {
+	case []byte:
+		*a, err = ParseAmount(string(value))
+	case string:
+		*a, err = ParseAmount(value)
+	case int64:
+		if value > int64(MaxAmount/amountScale) || value < -int64(MaxAmount/amountScale) {
+			return fmt.Errorf("%w: %d", ErrAmountOverflow, value)
+		}
+		*a = Amount(value * amountScale)
+	default:
+		err = fmt.Errorf("%w: can't scan %T", ErrInvalidAmount, src)
+	}
+
+	return err
+}
+
+// Value writes the amount as a decimal text, so it's stored without a float conversion.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
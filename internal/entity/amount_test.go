@@ -0,0 +1,361 @@
+package entity
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Amount
+		wantErr error
+	}{
+		{name: "integer", s: "500", want: 5000000},
+		{name: "fraction", s: "729.98", want: 7299800},
+		{name: "negative", s: "-12.5", want: -125000},
+		{name: "zero", s: "0", want: 0},
+		{name: "negative zero", s: "-0.0", want: 0},
+		{name: "four decimals", s: "0.0001", want: 1},
+		{name: "trailing zeros", s: "1.2000", want: 12000},
+		{name: "leading zeros", s: "007.5", want: 75000},
+		{name: "max", s: "999999999999.9999", want: MaxAmount},
+		{name: "min", s: "-999999999999.9999", want: -MaxAmount},
+		{name: "five decimals", s: "1.00001", wantErr: ErrInvalidAmount},
+		{name: "five zero decimals", s: "1.00000", wantErr: ErrInvalidAmount},
+		{name: "over max", s: "1000000000000", wantErr: ErrAmountOverflow},
+		{name: "over int64", s: "99999999999999999999", wantErr: ErrAmountOverflow},
+		{name: "empty", s: "", wantErr: ErrInvalidAmount},
+		{name: "only sign", s: "-", wantErr: ErrInvalidAmount},
+		{name: "plus sign", s: "+1", wantErr: ErrInvalidAmount},
+		{name: "no integer part", s: ".5", wantErr: ErrInvalidAmount},
+		{name: "no fraction digits", s: "5.", wantErr: ErrInvalidAmount},
+		{name: "comma", s: "1,5", wantErr: ErrInvalidAmount},
+		{name: "exponent", s: "1e2", wantErr: ErrInvalidAmount},
+		{name: "space", s: " 1", wantErr: ErrInvalidAmount},
+		{name: "two signs", s: "--1", wantErr: ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAmount(tt.s)
+			if !errors.Is(err, tt.wantErr) || (err != nil && tt.wantErr == nil) {
+				t.Fatalf("ParseAmount(%q) error = %v, want %v", tt.s, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAmount(%q) = %d, want %d", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundAmount(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Amount
+		wantErr error
+	}{
+		{name: "exact", s: "729.98", want: 7299800},
+		{name: "round down", s: "1.23454", want: 12345},
+		{name: "round half up", s: "1.23455", want: 12346},
+		{name: "negative round half away from zero", s: "-1.23455", want: -12346},
+		{name: "negative round down", s: "-1.23449", want: -12345},
+		{name: "long fraction", s: "0.123456789", want: 1235},
+		{name: "carry to integer", s: "9.99995", want: 100000},
+		{name: "to zero", s: "0.00004", want: 0},
+		{name: "negative to zero", s: "-0.00004", want: 0},
+		{name: "negative half", s: "-0.00005", want: -1},
+		{name: "exponent", s: "1.5e-4", want: 2},
+		{name: "exponent exact", s: "1.5E2", want: 1500000},
+		{name: "max", s: "999999999999.99994", want: MaxAmount},
+		{name: "rounded over max", s: "999999999999.99995", wantErr: ErrAmountOverflow},
+		{name: "rounded under min", s: "-999999999999.99995", wantErr: ErrAmountOverflow},
+		{name: "over max", s: "1e13", wantErr: ErrAmountOverflow},
+		{name: "empty", s: "", wantErr: ErrInvalidAmount},
+		{name: "letters in fraction", s: "1.2345x", wantErr: ErrInvalidAmount},
+		{name: "no integer part", s: ".123456", wantErr: ErrInvalidAmount},
+		{name: "exponent out of range", s: "1e-33", wantErr: ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RoundAmount(tt.s)
+			if !errors.Is(err, tt.wantErr) || (err != nil && tt.wantErr == nil) {
+				t.Fatalf("RoundAmount(%q) error = %v, want %v", tt.s, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RoundAmount(%q) = %d, want %d", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandExponent(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    string
+		wantErr bool
+	}{
+		{s: "12.5", want: "12.5"},
+		{s: "1.5e2", want: "150"},
+		{s: "1.5E+2", want: "150"},
+		{s: "-1.5e2", want: "-150"},
+		{s: "15e-1", want: "1.5"},
+		{s: "1.5e-2", want: "0.015"},
+		{s: "-1.5e-5", want: "-0.000015"},
+		{s: "1.50e1", want: "15"},
+		{s: "0e0", want: "0"},
+		{s: "1e32", want: "1" + strings.Repeat("0", maxAmountExponent)},
+		{s: "1e-32", want: "0." + strings.Repeat("0", maxAmountExponent-1) + "1"},
+		{s: "1e33", wantErr: true},
+		{s: "1e-33", wantErr: true},
+		{s: "1e1000000", wantErr: true},
+		{s: "1e", wantErr: true},
+		{s: "e5", wantErr: true},
+		{s: "1.e5", want: "100000"},
+		{s: ".5e1", wantErr: true},
+		{s: "1x.5e1", wantErr: true},
+		{s: "1e2e3", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := expandExponent(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandExponent(%q) error = %v, want error %v", tt.s, err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInvalidAmount) {
+					t.Errorf("expandExponent(%q) error = %v, want ErrInvalidAmount", tt.s, err)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("expandExponent(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	tests := []struct {
+		a    Amount
+		want string
+	}{
+		{a: 0, want: "0"},
+		{a: 5000000, want: "500"},
+		{a: 7299800, want: "729.98"},
+		{a: 1, want: "0.0001"},
+		{a: -1, want: "-0.0001"},
+		{a: -125000, want: "-12.5"},
+		{a: MaxAmount, want: "999999999999.9999"},
+		{a: -MaxAmount, want: "-999999999999.9999"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.a.String(); got != tt.want {
+				t.Errorf("Amount(%d).String() = %q, want %q", int64(tt.a), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAmountAddSub(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    Amount
+		sum     Amount
+		sumErr  bool
+		diff    Amount
+		diffErr bool
+	}{
+		{name: "small", a: 7299800, b: 125000, sum: 7424800, diff: 7174800},
+		{name: "negative", a: -5, b: -7, sum: -12, diff: 2},
+		{name: "at max", a: MaxAmount - 1, b: 1, sum: MaxAmount, diff: MaxAmount - 2},
+		{name: "over max", a: MaxAmount, b: 1, sumErr: true, diff: MaxAmount - 1},
+		{name: "under min", a: -MaxAmount, b: 1, sum: -MaxAmount + 1, diffErr: true},
+		{name: "int64 wrap", a: math.MaxInt64, b: 1, sumErr: true, diffErr: true},
+		{name: "min int64", a: 0, b: math.MinInt64, sumErr: true, diffErr: true},
+		{name: "max int64", a: 0, b: math.MaxInt64, sumErr: true, diffErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sum, err := tt.a.Add(tt.b)
+			if tt.sumErr {
+				if !errors.Is(err, ErrAmountOverflow) {
+					t.Errorf("%d + %d error = %v, want ErrAmountOverflow", tt.a, tt.b, err)
+				}
+			} else if err != nil || sum != tt.sum {
+				t.Errorf("%d + %d = %d, %v, want %d", tt.a, tt.b, sum, err, tt.sum)
+			}
+
+			diff, err := tt.a.Sub(tt.b)
+			if tt.diffErr {
+				if !errors.Is(err, ErrAmountOverflow) {
+					t.Errorf("%d - %d error = %v, want ErrAmountOverflow", tt.a, tt.b, err)
+				}
+			} else if err != nil || diff != tt.diff {
+				t.Errorf("%d - %d = %d, %v, want %d", tt.a, tt.b, diff, err, tt.diff)
+			}
+		})
+	}
+}
+
+func TestAmountNeg(t *testing.T) {
+	for _, a := range []Amount{0, 1, -1, 7299800, MaxAmount, -MaxAmount} {
+		if got := a.Neg(); got != -a || got.Neg() != a {
+			t.Errorf("Amount(%d).Neg() = %d", a, got)
+		}
+		if sum, err := a.Add(a.Neg()); err != nil || sum != 0 {
+			t.Errorf("%d + %d = %d, %v, want 0", a, a.Neg(), sum, err)
+		}
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    Amount
+		wantErr error
+	}{
+		{data: `729.98`, want: 7299800},
+		{data: `-12.5`, want: -125000},
+		{data: `0`, want: 0},
+		{data: `1.5e2`, want: 1500000},
+		{data: `1E-4`, want: 1},
+		{data: `123.45e-2`, want: 12345},
+		{data: `null`, want: 42},
+		{data: `1e-5`, wantErr: ErrInvalidAmount},
+		{data: `1.23456`, wantErr: ErrInvalidAmount},
+		{data: `1e13`, wantErr: ErrAmountOverflow},
+		{data: `1e1000000`, wantErr: ErrInvalidAmount},
+		{data: `"5"`, wantErr: ErrInvalidAmount},
+		{data: `true`, wantErr: ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			a := Amount(42)
+			err := a.UnmarshalJSON([]byte(tt.data))
+			if !errors.Is(err, tt.wantErr) || (err != nil && tt.wantErr == nil) {
+				t.Fatalf("UnmarshalJSON(%s) error = %v, want %v", tt.data, err, tt.wantErr)
+			}
+			if err == nil && a != tt.want {
+				t.Errorf("UnmarshalJSON(%s) = %d, want %d", tt.data, a, tt.want)
+			}
+		})
+	}
+
+	b, err := json.Marshal(struct {
+		Current   Amount  `json:"current"`
+		Withdrawn *Amount `json:"withdrawn"`
+	}{Current: 7299800})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"current":729.98,"withdrawn":null}`; string(b) != want {
+		t.Errorf("Marshal = %s, want %s", b, want)
+	}
+}
+
+func TestAmountScanValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    Amount
+		wantErr error
+	}{
+		{name: "bytes", src: []byte("729.9800"), want: 7299800},
+		{name: "string", src: "-12.5000", want: -125000},
+		{name: "int64", src: int64(500), want: 5000000},
+		{name: "int64 over max", src: int64(1e12), wantErr: ErrAmountOverflow},
+		{name: "int64 under min", src: int64(-1e12), wantErr: ErrAmountOverflow},
+		{name: "too many decimals", src: "1.00001", wantErr: ErrInvalidAmount},
+		{name: "float64", src: 1.5, wantErr: ErrInvalidAmount},
+		{name: "nil", src: nil, wantErr: ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a Amount
+			err := a.Scan(tt.src)
+			if !errors.Is(err, tt.wantErr) || (err != nil && tt.wantErr == nil) {
+				t.Fatalf("Scan(%v) error = %v, want %v", tt.src, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if a != tt.want {
+				t.Errorf("Scan(%v) = %d, want %d", tt.src, a, tt.want)
+			}
+
+			value, err := a.Value()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var again Amount
+			if err = again.Scan(value); err != nil || again != a {
+				t.Errorf("Scan(Value()) = %d, %v, want %d", again, err, a)
+			}
+		})
+	}
+}
+
+func FuzzAmountJSON(f *testing.F) {
+	for _, seed := range []string{"0", "729.98", "-12.5", "1.5e2", "1e-4", "1e-5", "999999999999.9999", "1e1000000", "null"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data string) {
+		var a Amount
+		if err := a.UnmarshalJSON([]byte(data)); err != nil {
+			if !errors.Is(err, ErrInvalidAmount) && !errors.Is(err, ErrAmountOverflow) {
+				t.Fatalf("UnmarshalJSON(%q) returned an unexpected error: %v", data, err)
+			}
+			return
+		}
+		if a > MaxAmount || a < -MaxAmount {
+			t.Fatalf("UnmarshalJSON(%q) = %d is out of MaxAmount", data, a)
+		}
+
+		b, err := a.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var again Amount
+		if err = again.UnmarshalJSON(b); err != nil || again != a {
+			t.Fatalf("round trip of %q through %s = %d, %v, want %d", data, b, again, err, a)
+		}
+	})
+}
+
+func FuzzRoundAmount(f *testing.F) {
+	for _, seed := range []string{"0", "729.98", "1.23455", "-0.00005", "1.5e-5", "999999999999.99995", "1.2345x"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		rounded, err := RoundAmount(s)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidAmount) && !errors.Is(err, ErrAmountOverflow) {
+				t.Fatalf("RoundAmount(%q) returned an unexpected error: %v", s, err)
+			}
+			return
+		}
+		if rounded > MaxAmount || rounded < -MaxAmount {
+			t.Fatalf("RoundAmount(%q) = %d is out of MaxAmount", s, rounded)
+		}
+
+		// a number exact to AmountDecimals isn't changed by rounding
+		if exact, err := ParseAmount(s); err == nil && exact != rounded {
+			t.Fatalf("RoundAmount(%q) = %d, ParseAmount = %d", s, rounded, exact)
+		}
+	})
+}
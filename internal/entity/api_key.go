@@ -0,0 +1,25 @@
+package entity
+
+import "time"
+
+// Scopes of API keys.
+const (
+	ScopeOrdersWrite = "orders:write"
+	ScopeOrdersRead  = "orders:read"
+	ScopeBalanceRead = "balance:read"
+)
+
+// APIKey lets a partner service act on behalf of users within its scopes, the key itself is stored only as a hash.
+type APIKey struct {
+	ID        string     `json:"id" db:"id"`
+	Name      string     `json:"name" db:"name"`
+	KeyHash   string     `json:"-" db:"key_hash"`
+	Scopes    []string   `json:"scopes" db:"scopes"`
+	CreatedBy string     `json:"created_by" db:"created_by"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	return contains(k.Scopes, scope)
+}
@@ -0,0 +1,60 @@
+package entity
+
+import "strings"
+
+const (
+	LedgerAccrual    = "ACCRUAL"
+	LedgerWithdrawal = "WITHDRAWAL"
+	LedgerAdjustment = "ADJUSTMENT"
+)
+
+// LedgerEntry is one side of a balance change. Every change is written as a transaction of two entries:
+// the user's account and the system account of the entry type, so the amounts of a transaction sum to zero.
+type LedgerEntry struct {
+	ID            int64  `json:"id" db:"id"`
+	TransactionID int64  `json:"transaction_id" db:"transaction_id"`
+	Account       string `json:"-" db:"account"`
+	UserLogin     string `json:"-" db:"login"`
+	OrderID       string `json:"order,omitempty" db:"order_id"`
+	Type          string `json:"type" db:"type"`
+	Amount        Amount `json:"amount" db:"amount"`
+	ReasonCode    string `json:"reason_code,omitempty" db:"reason_code"`
+	Comment       string `json:"comment,omitempty" db:"comment"`
+	CreatedBy     string `json:"-" db:"created_by"`
+	CreatedAt     string `json:"created_at" db:"created_at"`
+}
+
+// Reason codes of manual adjustments.
+const (
+	ReasonGoodwill    = "GOODWILL"
+	ReasonCorrection  = "CORRECTION"
+	ReasonLostAccrual = "LOST_ACCRUAL"
+	ReasonFraud       = "FRAUD"
+	ReasonOther       = "OTHER"
+)
+
+// Adjustment is a manual credit (positive amount) or debit (negative amount) of the user balance by support.
+type Adjustment struct {
+	UserLogin  string `json:"-"`
+	Amount     Amount `json:"amount"`
+	ReasonCode string `json:"reason_code"`
+	Comment    string `json:"comment"`
+	CreatedBy  string `json:"-"`
+}
+
+// BalanceDrift is a user whose balance counters differ from the sums of the user's ledger entries.
+type BalanceDrift struct {
+	Login           string `db:"login"`
+	Current         Amount `db:"current"`
+	LedgerCurrent   Amount `db:"ledger_current"`
+	Withdrawn       Amount `db:"withdrawn"`
+	LedgerWithdrawn Amount `db:"ledger_withdrawn"`
+}
+
+func UserAccount(login string) string {
+	return "user:" + login
+}
+
+func SystemAccount(entryType string) string {
+	return "system:" + strings.ToLower(entryType)
+}
@@ -0,0 +1,74 @@
+package entity
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListFilter selects a page of the user orders or withdrawals. Lists are sorted by the upload time of an order
+// or the processing time of a withdrawal, oldest first, and by the order number between equal times.
+type ListFilter struct {
+	// Limit is the page size, zero for the whole list.
+	Limit int
+	// Cursor is the last item of the previous page, nil for the first page.
+	Cursor *Cursor
+	// Statuses keeps orders with any of the statuses, all orders if empty.
+	Statuses []string
+	// From and To bound the time as [From, To), a zero time doesn't bound it.
+	From time.Time
+	To   time.Time
+}
+
+// Cursor is the sort key of the last item of a page, the next page starts right after it.
+type Cursor struct {
+	Time    time.Time
+	OrderID string
+}
+
+// String encodes the cursor as an opaque url-safe token.
+func (c Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Time.Format(time.RFC3339Nano) + "|" + c.OrderID))
+}
+
+// After reports whether the item of the time and order number goes after the cursor in the list.
+func (c Cursor) After(t time.Time, orderID string) bool {
+	return t.After(c.Time) || (t.Equal(c.Time) && orderID > c.OrderID)
+}
+
+func ParseCursor(token string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	value, orderID, ok := strings.Cut(string(raw), "|")
+	if !ok || orderID == "" {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return Cursor{Time: t, OrderID: orderID}, nil
+}
+
+// Match reports whether an item of the time and status passes the filter, the cursor and the limit aside.
+func (f ListFilter) Match(t time.Time, status string) bool {
+	if len(f.Statuses) > 0 && !contains(f.Statuses, status) {
+		return false
+	}
+	if !f.From.IsZero() && t.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !t.Before(f.To) {
+		return false
+	}
+
+	return true
+}
@@ -1,59 +1,164 @@
 package entity
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
 type Order struct {
-	OrderID    string  `db:"order_id"`
-	UserLogin  string  `db:"login"`
-	Status     string  `db:"status"`
-	Accrual    float64 `db:"accrual"`
-	UploadedAt string  `db:"uploaded_at"`
+	OrderID      string `db:"order_id"`
+	UserLogin    string `db:"login"`
+	Status       string `db:"status"`
+	Accrual      Amount `db:"accrual"`
+	UploadedAt   string `db:"uploaded_at"`
+	PollAttempts int    `db:"poll_attempts"`
+	// APIKeyID is the partner key the order was uploaded with, empty for orders uploaded by the user.
+	APIKeyID string `db:"api_key_id"`
+}
+
+// OrderRetry schedules the next poll of an order after a failed one.
+type OrderRetry struct {
+	OrderID    string
+	Attempts   int
+	NextPollAt time.Time
+	LastError  string
+	DeadLetter bool
 }
 
 type OrderWithdraw struct {
-	OrderID     string  `json:"order" db:"order_id"`
-	UserLogin   string  `db:"login"`
-	Value       float64 `json:"sum" db:"value"`
-	ProcessedAt string  `json:"processed_at,omitempty" db:"processed_at"`
+	OrderID     string `json:"order" db:"order_id"`
+	UserLogin   string `db:"login"`
+	Value       Amount `json:"sum" db:"value"`
+	ProcessedAt string `json:"processed_at,omitempty" db:"processed_at"`
 }
 
 type Orders struct {
-	OrderID    string  `json:"number" db:"order_id"`
-	Status     string  `json:"status" db:"status"`
-	Accrual    float64 `json:"accrual,omitempty" db:"accrual"`
-	UploadedAt string  `json:"uploaded_at" db:"uploaded_at"`
+	OrderID    string `json:"number" db:"order_id"`
+	Status     string `json:"status" db:"status"`
+	Accrual    Amount `json:"accrual,omitempty" db:"accrual"`
+	UploadedAt string `json:"uploaded_at" db:"uploaded_at"`
+}
+
+// OrderStatusChange is a status transition of an order.
+type OrderStatusChange struct {
+	Status    string `json:"status" db:"status"`
+	ChangedAt string `json:"changed_at" db:"changed_at"`
+}
+
+// OrderDetails is an order of the user with the timeline of its statuses, oldest first.
+type OrderDetails struct {
+	Orders
+	History []OrderStatusChange `json:"history"`
+}
+
+// Results of an order in a batch upload.
+const (
+	UploadAccepted        = "accepted"
+	UploadAlreadyUploaded = "already_uploaded"
+	UploadConflict        = "conflict"
+	UploadInvalid         = "invalid"
+	UploadTooLong         = "too_long"
+)
+
+// OrderUploadResult is the result of one order number of a batch upload.
+type OrderUploadResult struct {
+	Number string `json:"number"`
+	Result string `json:"result"`
 }
 
 type Accrual struct {
-	OrderID string   `json:"order"`
-	Status  string   `json:"status,omitempty"`
-	Accrual *float64 `json:"accrual,omitempty"`
+	OrderID string  `json:"order"`
+	Status  string  `json:"status,omitempty"`
+	Accrual *Amount `json:"accrual,omitempty"`
+}
+
+// UnmarshalJSON rounds the accrual to AmountDecimals, the accrual system doesn't limit the decimal places.
+func (a *Accrual) UnmarshalJSON(data []byte) error {
+	type accrual Accrual
+	value := struct {
+		*accrual
+		Accrual *json.Number `json:"accrual,omitempty"`
+	}{accrual: (*accrual)(a)}
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if value.Accrual == nil {
+		return nil
+	}
+
+	rounded, err := RoundAmount(value.Accrual.String())
+	if err != nil {
+		return err
+	}
+	a.Accrual = &rounded
+
+	return nil
 }
 
+const (
+	StatusNew        = "NEW"
+	StatusProcessing = "PROCESSING"
+	StatusInvalid    = "INVALID"
+	StatusProcessed  = "PROCESSED"
+)
+
 var CompletedStatus = []string{
 	"NEW",
 	"PROCESSING",
 	"INVALID",
 }
 
-// Valid check number is valid or not based on Luhn algorithm
-func Valid(number int) bool {
-	return (number%10+checksum(number/10))%10 == 0
+// maxOrderNumberLength is the size of the order_id columns.
+const maxOrderNumberLength = 64
+
+var (
+	ErrInvalidOrderNumber = errors.New("invalid order number")
+	ErrOrderNumberTooLong = fmt.Errorf("order number is longer than %d digits", maxOrderNumberLength)
+)
+
+// NormalizeOrderNumber drops whitespace around the number and checks it with Valid, whitespace inside
+// the number makes it invalid. Leading zeros are kept. A number longer than maxOrderNumberLength digits
+// is rejected with ErrOrderNumberTooLong, since it can't be stored.
+func NormalizeOrderNumber(number string) (string, error) {
+	normalized := strings.TrimSpace(number)
+
+	if len(normalized) > maxOrderNumberLength {
+		return "", fmt.Errorf("%w: %q", ErrOrderNumberTooLong, number)
+	}
+	if !Valid(normalized) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidOrderNumber, number)
+	}
+
+	return normalized, nil
 }
 
-func checksum(number int) int {
-	var luhn int
+// Valid checks a number of decimal digits of any length with the Luhn algorithm.
+func Valid(number string) bool {
+	if number == "" {
+		return false
+	}
 
-	for i := 0; number > 0; i++ {
-		cur := number % 10
+	var luhn int
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := number[i]
+		if digit < '0' || digit > '9' {
+			return false
+		}
 
-		if i%2 == 0 { // even
+		cur := int(digit - '0')
+		if (len(number)-1-i)%2 == 1 {
 			cur = cur * 2
 			if cur > 9 {
-				cur = cur%10 + cur/10
+				cur = cur - 9
 			}
 		}
 
 		luhn += cur
-		number = number / 10
 	}
-	return luhn % 10
+
+	return luhn%10 == 0
 }
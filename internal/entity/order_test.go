@@ -0,0 +1,178 @@
+package entity
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		name   string
+		number string
+		want   bool
+	}{
+		{name: "valid", number: "79927398713", want: true},
+		{name: "wrong check digit", number: "79927398710", want: false},
+		{name: "zero", number: "0", want: true},
+		{name: "empty", number: "", want: false},
+		{name: "leading zeros", number: "0079927398713", want: true},
+		{name: "more than 19 digits", number: "12345678901234567894", want: true},
+		{name: "more than 19 digits wrong check digit", number: "12345678901234567890", want: false},
+		{name: "non-ASCII digits", number: "٧٩٩٢٧٣٩٨٧١٣", want: false},
+		{name: "fullwidth digits", number: "７９９２７３９８７１３", want: false},
+		{name: "sign", number: "-79927398713", want: false},
+		{name: "inner space", number: "7992 7398713", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Valid(tt.number); got != tt.want {
+				t.Errorf("Valid(%q) = %v, want %v", tt.number, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeOrderNumber(t *testing.T) {
+	maxDigits := luhnNumber(strings.Repeat("1", maxOrderNumberLength-1))
+
+	tests := []struct {
+		name    string
+		number  string
+		want    string
+		wantErr error
+	}{
+		{name: "valid", number: "79927398713", want: "79927398713"},
+		{name: "leading zeros kept", number: "0079927398713", want: "0079927398713"},
+		{name: "more than 19 digits", number: "12345678901234567894", want: "12345678901234567894"},
+		{name: "surrounding whitespace", number: " \t79927398713\r\n", want: "79927398713"},
+		{name: "surrounding unicode whitespace", number: "\u00a079927398713\u3000", want: "79927398713"},
+		{name: "inner space", number: "7992 7398 713", wantErr: ErrInvalidOrderNumber},
+		{name: "inner tab", number: "79927\t398713", wantErr: ErrInvalidOrderNumber},
+		{name: "non-ASCII digits", number: "٧٩٩٢٧٣٩٨٧١٣", wantErr: ErrInvalidOrderNumber},
+		{name: "wrong check digit", number: "79927398710", wantErr: ErrInvalidOrderNumber},
+		{name: "empty", number: "", wantErr: ErrInvalidOrderNumber},
+		{name: "only whitespace", number: "  \n", wantErr: ErrInvalidOrderNumber},
+		{name: "64 digits", number: maxDigits, want: maxDigits},
+		{name: "64 digits in whitespace", number: " " + maxDigits + "\n", want: maxDigits},
+		{name: "65 digits", number: luhnNumber(strings.Repeat("1", maxOrderNumberLength)), wantErr: ErrOrderNumberTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeOrderNumber(tt.number)
+			if !errors.Is(err, tt.wantErr) || (err != nil && tt.wantErr == nil) {
+				t.Fatalf("NormalizeOrderNumber(%q) error = %v, want %v", tt.number, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeOrderNumber(%q) = %q, want %q", tt.number, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccrualUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{name: "exact", data: `{"order":"79927398713","status":"PROCESSED","accrual":729.98}`, want: "729.98"},
+		{name: "rounded", data: `{"order":"79927398713","status":"PROCESSED","accrual":729.98765}`, want: "729.9877"},
+		{name: "rounded exponent", data: `{"order":"79927398713","status":"PROCESSED","accrual":1.23456e-1}`, want: "0.1235"},
+		{name: "no accrual", data: `{"order":"79927398713","status":"PROCESSING"}`},
+		{name: "null accrual", data: `{"order":"79927398713","status":"PROCESSING","accrual":null}`},
+		{name: "accrual over max", data: `{"order":"79927398713","status":"PROCESSED","accrual":1e13}`, wantErr: true},
+		{name: "accrual string", data: `{"order":"79927398713","status":"PROCESSED","accrual":"many"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var accrual Accrual
+			err := json.Unmarshal([]byte(tt.data), &accrual)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if accrual.OrderID != "79927398713" || accrual.Status == "" {
+				t.Errorf("Unmarshal lost the order fields: %+v", accrual)
+			}
+			switch {
+			case tt.want == "" && accrual.Accrual != nil:
+				t.Errorf("accrual = %s, want none", accrual.Accrual)
+			case tt.want != "" && (accrual.Accrual == nil || accrual.Accrual.String() != tt.want):
+				t.Errorf("accrual = %v, want %s", accrual.Accrual, tt.want)
+			}
+		})
+	}
+}
+
+func FuzzValid(f *testing.F) {
+	for _, seed := range []string{"", "0", "79927398713", "0079927398713", "12345678901234567894", "٧٩٩", "1 2"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, number string) {
+		if !Valid(number) {
+			return
+		}
+		if strings.Trim(number, "0123456789") != "" {
+			t.Fatalf("Valid(%q) accepted a non-digit", number)
+		}
+		if Valid(changeLastDigit(number)) {
+			t.Fatalf("Valid accepted both %q and %q", number, changeLastDigit(number))
+		}
+	})
+}
+
+func FuzzNormalizeOrderNumber(f *testing.F) {
+	for _, seed := range []string{"", " 79927398713 ", "7992 7398713", "0079927398713", " 0 ", "٧٩٩"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, number string) {
+		normalized, err := NormalizeOrderNumber(number)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidOrderNumber) && !errors.Is(err, ErrOrderNumberTooLong) {
+				t.Fatalf("NormalizeOrderNumber(%q) returned an unexpected error: %v", number, err)
+			}
+			return
+		}
+
+		if normalized != strings.TrimSpace(number) {
+			t.Fatalf("NormalizeOrderNumber(%q) = %q changed more than the surrounding whitespace", number, normalized)
+		}
+		if !Valid(normalized) || len(normalized) > maxOrderNumberLength {
+			t.Fatalf("NormalizeOrderNumber(%q) = %q isn't a storable valid number", number, normalized)
+		}
+		if again, err := NormalizeOrderNumber(normalized); err != nil || again != normalized {
+			t.Fatalf("NormalizeOrderNumber isn't idempotent on %q: %q, %v", normalized, again, err)
+		}
+	})
+}
+
+// luhnNumber appends the Luhn check digit to the digits.
+func luhnNumber(digits string) string {
+	for check := '0'; check <= '9'; check++ {
+		if number := digits + string(check); Valid(number) {
+			return number
+		}
+	}
+
+	panic("no check digit for " + digits)
+}
+
+// changeLastDigit replaces the last digit of the number with the next one, a single digit change
+// the Luhn algorithm always detects.
+func changeLastDigit(number string) string {
+	last := number[len(number)-1]
+	next := '0' + (last-'0'+1)%10
+
+	return number[:len(number)-1] + string(rune(next))
+}
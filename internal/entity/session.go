@@ -0,0 +1,31 @@
+package entity
+
+import "time"
+
+// Session is a refresh token session, the token itself is stored only as a hash.
+type Session struct {
+	ID               string     `db:"id"`
+	FamilyID         string     `db:"family_id"`
+	UserLogin        string     `db:"login"`
+	RefreshTokenHash string     `db:"refresh_token_hash"`
+	CreatedAt        time.Time  `db:"created_at"`
+	ExpiresAt        time.Time  `db:"expires_at"`
+	RotatedAt        *time.Time `db:"rotated_at"`
+	RevokedAt        *time.Time `db:"revoked_at"`
+}
+
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// PasswordReset is a single-use password reset token, the token itself is stored only as a hash.
+type PasswordReset struct {
+	TokenHash string     `db:"token_hash"`
+	UserLogin string     `db:"login"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
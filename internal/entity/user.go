@@ -1,14 +1,66 @@
 package entity
 
+import "time"
+
+// RoleAdmin grants access to the admin API.
+const RoleAdmin = "admin"
+
 type User struct {
-	Login     string  `json:"login" db:"login"`
-	Password  string  `json:"password" db:"password"`
-	Current   float64 `db:"current"`
-	Withdrawn float64 `db:"withdrawn"`
+	Login           string     `json:"login" db:"login"`
+	Password        string     `json:"password" db:"password"`
+	Current         Amount     `db:"current"`
+	Withdrawn       Amount     `db:"withdrawn"`
+	TokenGeneration int        `json:"-" db:"token_generation"`
+	Roles           []string   `json:"-" db:"roles"`
+	BlockedAt       *time.Time `json:"-" db:"blocked_at"`
 }
 
 type Balance struct {
-	Login     string  `json:"-" db:"login"`
-	Current   float64 `json:"current" db:"current"`
-	Withdrawn float64 `json:"withdrawn" db:"withdrawn"`
+	Login     string `json:"-" db:"login"`
+	Current   Amount `json:"current" db:"current"`
+	Withdrawn Amount `json:"withdrawn" db:"withdrawn"`
+}
+
+// Account is the user as it's seen by support staff in the admin API.
+type Account struct {
+	Login     string     `json:"login"`
+	Roles     []string   `json:"roles"`
+	BlockedAt *time.Time `json:"blocked_at,omitempty"`
+	Current   Amount     `json:"current"`
+	Withdrawn Amount     `json:"withdrawn"`
+}
+
+// Identity is the authenticated user of a request, taken from the access token.
+type Identity struct {
+	Login      string
+	Roles      []string
+	TokenID    string
+	SessionID  string
+	Generation int
+	ExpiresAt  time.Time
+}
+
+// TokenState is the server-side state an access token is checked against on every request.
+type TokenState struct {
+	Generation int
+	Revoked    bool
+	Blocked    bool
+}
+
+func (i Identity) HasRole(role string) bool {
+	return contains(i.Roles, role)
+}
+
+func (u User) HasRole(role string) bool {
+	return contains(u.Roles, role)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
 }
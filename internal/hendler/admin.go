@@ -0,0 +1,360 @@
+package hendler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+	"github.com/IgorAleksandroff/gophermart/internal/repository"
+	"github.com/IgorAleksandroff/gophermart/internal/usecase"
+	"github.com/go-chi/chi"
+)
+
+const (
+	loginParam    = "login"
+	apiKeyIDParam = "id"
+)
+
+// RequireRole lets through only users with the role, it must follow UserIdentity.
+func (h *handler) RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, ok := r.Context().Value(identityCtxKey{}).(entity.Identity)
+			if !ok {
+				http.Error(w, "unknown user", http.StatusUnauthorized)
+				return
+			}
+
+			if !identity.HasRole(role) {
+				h.l.Warn("user %s without role %s requested %s", identity.Login, role, r.URL.Path)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (h *handler) HandleAdminGetUser(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.adminAccount(w, r)
+	if !ok {
+		return
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(buf)
+	if err := jsonEncoder.Encode(account); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func (h *handler) HandleAdminGetUserOrders(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.adminAccount(w, r)
+	if !ok {
+		return
+	}
+
+	filter, err := listFilter(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	orders, next, err := h.ordersUC.GetOrders(r.Context(), account.Login, filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(orders) == 0 {
+		http.Error(w, "empty slice", http.StatusNoContent)
+		return
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(buf)
+	if err = jsonEncoder.Encode(orders); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if next != "" {
+		w.Header().Set(nextCursorHeader, next)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func (h *handler) HandleAdminGetUserWithdrawals(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.adminAccount(w, r)
+	if !ok {
+		return
+	}
+
+	filter, err := listFilter(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	withdrawals, next, err := h.ordersUC.GetWithdrawals(r.Context(), account.Login, filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(withdrawals) == 0 {
+		http.Error(w, "empty slice", http.StatusNoContent)
+		return
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(buf)
+	if err = jsonEncoder.Encode(withdrawals); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if next != "" {
+		w.Header().Set(nextCursorHeader, next)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// HandleAdminBlockUser blocks the user, all user tokens are revoked at once.
+func (h *handler) HandleAdminBlockUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserBlocked(w, r, true)
+}
+
+func (h *handler) HandleAdminUnblockUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserBlocked(w, r, false)
+}
+
+// HandleAdminAdjustBalance credits or debits the user balance with a reason code and a comment.
+func (h *handler) HandleAdminAdjustBalance(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	contentTypeHeaderValue := r.Header.Get("Content-Type")
+	if !strings.Contains(contentTypeHeaderValue, "application/json") {
+		http.Error(w, "unknown content-type", http.StatusBadRequest)
+		return
+	}
+
+	if r.Body == nil {
+		http.Error(w, "empty body", http.StatusBadRequest)
+		return
+	}
+
+	adjustment := entity.Adjustment{}
+	reader := json.NewDecoder(r.Body)
+	if err := reader.Decode(&adjustment); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	adjustment.UserLogin = chi.URLParam(r, loginParam)
+	adjustment.CreatedBy = r.Header.Get(userCtx)
+
+	account, err := h.admin.Adjust(ctx, adjustment)
+	if err != nil {
+		h.l.Warn(err.Error())
+		var validationErr *usecase.ValidationError
+		if errors.As(err, &validationErr) {
+			h.writeValidationError(w, validationErr)
+			return
+		}
+		if errors.Is(err, repository.ErrUserLogin) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, usecase.ErrLowBalance) {
+			http.Error(w, err.Error(), http.StatusPaymentRequired)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.l.Info("balance of %s adjusted by %s: %v %s", adjustment.UserLogin, adjustment.CreatedBy,
+		adjustment.Amount, adjustment.ReasonCode)
+
+	buf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(buf)
+	if err = jsonEncoder.Encode(account); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(buf.Bytes())
+}
+
+// HandleAdminResetPassword sends the user a password reset token through the notifier.
+func (h *handler) HandleAdminResetPassword(w http.ResponseWriter, r *http.Request) {
+	account, ok := h.adminAccount(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.passwords.RequestReset(r.Context(), account.Login); err != nil {
+		h.l.Warn(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// HandleAdminCreateAPIKey creates a partner API key, the key is in the answer only this time.
+func (h *handler) HandleAdminCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	contentTypeHeaderValue := r.Header.Get("Content-Type")
+	if !strings.Contains(contentTypeHeaderValue, "application/json") {
+		http.Error(w, "unknown content-type", http.StatusBadRequest)
+		return
+	}
+
+	if r.Body == nil {
+		http.Error(w, "empty body", http.StatusBadRequest)
+		return
+	}
+
+	request := struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}{}
+	reader := json.NewDecoder(r.Body)
+	if err := reader.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	apiKey, key, err := h.apiKeys.Create(ctx, request.Name, request.Scopes, r.Header.Get(userCtx))
+	if err != nil {
+		h.l.Warn(err.Error())
+		var validationErr *usecase.ValidationError
+		if errors.As(err, &validationErr) {
+			h.writeValidationError(w, validationErr)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.l.Info("api key %s (%s) created by %s", apiKey.ID, apiKey.Name, apiKey.CreatedBy)
+
+	buf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(buf)
+	err = jsonEncoder.Encode(struct {
+		entity.APIKey
+		Key string `json:"key"`
+	}{APIKey: apiKey, Key: key})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(buf.Bytes())
+}
+
+func (h *handler) HandleAdminGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.apiKeys.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(keys) == 0 {
+		http.Error(w, "empty slice", http.StatusNoContent)
+		return
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(buf)
+	if err = jsonEncoder.Encode(keys); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+func (h *handler) HandleAdminRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, apiKeyIDParam)
+
+	if err := h.apiKeys.Revoke(r.Context(), id); err != nil {
+		h.l.Warn(err.Error())
+		if errors.Is(err, usecase.ErrUnknownAPIKey) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.l.Info("api key %s revoked by %s", id, r.Header.Get(userCtx))
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *handler) setUserBlocked(w http.ResponseWriter, r *http.Request, blocked bool) {
+	ctx := r.Context()
+	login := chi.URLParam(r, loginParam)
+
+	var err error
+	if blocked {
+		err = h.admin.BlockUser(ctx, login)
+	} else {
+		err = h.admin.UnblockUser(ctx, login)
+	}
+	if err != nil {
+		h.l.Warn(err.Error())
+		if errors.Is(err, repository.ErrUserLogin) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// adminAccount finds the user of the {login} URL parameter, it answers 404 itself if there is no such user.
+func (h *handler) adminAccount(w http.ResponseWriter, r *http.Request) (entity.Account, bool) {
+	account, err := h.admin.GetAccount(r.Context(), chi.URLParam(r, loginParam))
+	if err != nil {
+		if errors.Is(err, repository.ErrUserLogin) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return entity.Account{}, false
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return entity.Account{}, false
+	}
+
+	return account, true
+}
@@ -0,0 +1,123 @@
+package hendler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+	"github.com/IgorAleksandroff/gophermart/internal/usecase"
+)
+
+func TestRequireRole(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	userHeader := env.register(t, "alice")
+	env.register(t, "bob")
+
+	if w := env.do(t, http.MethodGet, "/api/admin/users/bob", "", userHeader); w.Code != http.StatusForbidden {
+		t.Errorf("user without the role: status = %d, want 403: %s", w.Code, w.Body.String())
+	}
+	if w := env.do(t, http.MethodGet, "/api/admin/users/bob", "", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("no token: status = %d, want 401: %s", w.Code, w.Body.String())
+	}
+
+	if err := env.admin.SetRole(ctx, "alice", entity.RoleAdmin, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// the roles are in the token, a change of them revokes the tokens issued before
+	if w := env.do(t, http.MethodGet, "/api/admin/users/bob", "", userHeader); w.Code != http.StatusUnauthorized {
+		t.Errorf("token issued before the grant: status = %d, want 401: %s", w.Code, w.Body.String())
+	}
+
+	adminHeader := env.login(t, "alice")
+	if w := env.do(t, http.MethodGet, "/api/admin/users/bob", "", adminHeader); w.Code != http.StatusOK {
+		t.Errorf("admin: status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestUserIdentityBlockedUser(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	header := env.register(t, "alice")
+	if w := env.do(t, http.MethodGet, "/api/user/balance", "", header); w.Code != http.StatusOK {
+		t.Fatalf("before the block: status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	if err := env.admin.BlockUser(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := env.do(t, http.MethodGet, "/api/user/balance", "", header); w.Code != http.StatusForbidden {
+		t.Errorf("token of a blocked user: status = %d, want 403: %s", w.Code, w.Body.String())
+	}
+
+	body := `{"login":"alice","password":"` + testPassword + `"}`
+	w := env.do(t, http.MethodPost, "/api/user/login", body, map[string]string{"Content-Type": "application/json"})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("login of a blocked user: status = %d, want 403: %s", w.Code, w.Body.String())
+	}
+
+	if err := env.admin.UnblockUser(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if w := env.do(t, http.MethodGet, "/api/user/balance", "", env.login(t, "alice")); w.Code != http.StatusOK {
+		t.Errorf("after the unblock: status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleAdminAdjustBalanceOverdraw(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+
+	env.register(t, "alice")
+	if err := env.admin.SetRole(ctx, "alice", entity.RoleAdmin, true); err != nil {
+		t.Fatal(err)
+	}
+	header := env.login(t, "alice")
+	header["Content-Type"] = "application/json"
+	env.register(t, "bob")
+
+	const path = "/api/admin/users/bob/adjustments"
+	w := env.do(t, http.MethodPost, path, `{"amount":5,"reason_code":"GOODWILL","comment":"sorry"}`, header)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("credit: status = %d, want 201: %s", w.Code, w.Body.String())
+	}
+
+	w = env.do(t, http.MethodPost, path, `{"amount":-5.0001,"reason_code":"FRAUD","comment":"chargeback"}`, header)
+	if w.Code != http.StatusPaymentRequired {
+		t.Errorf("overdraw: status = %d, want 402: %s", w.Code, w.Body.String())
+	}
+
+	overdraw, _ := entity.ParseAmount("-5.0001")
+	_, err := env.admin.Adjust(ctx, entity.Adjustment{
+		UserLogin:  "bob",
+		Amount:     overdraw,
+		ReasonCode: entity.ReasonFraud,
+		Comment:    "chargeback",
+		CreatedBy:  "alice",
+	})
+	if !errors.Is(err, usecase.ErrLowBalance) {
+		t.Errorf("Adjust error = %v, want ErrLowBalance", err)
+	}
+
+	account, err := env.admin.GetAccount(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := entity.ParseAmount("5"); account.Current != want {
+		t.Errorf("balance = %v, want %v", account.Current, want)
+	}
+
+	entries, err := env.ledger.GetLedger(ctx, "bob", 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Type != entity.LedgerAdjustment || entries[0].Amount != account.Current {
+		t.Errorf("ledger = %+v, want only the credit", entries)
+	}
+}
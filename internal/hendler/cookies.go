@@ -0,0 +1,79 @@
+package hendler
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+)
+
+const (
+	accessCookie  = "gm_access"
+	refreshCookie = "gm_refresh"
+	// csrfCookie is readable by scripts, they send it back in csrfHeader, which a foreign site can't do.
+	csrfCookie = "gm_csrf"
+	csrfHeader = "X-CSRF-Token"
+
+	// refreshCookiePath keeps the refresh token out of all requests but the refresh one.
+	refreshCookiePath = "/api/user/token/refresh"
+	csrfTokenLength   = 32
+)
+
+type cookieConfig struct {
+	secure     bool
+	sameSite   http.SameSite
+	refreshTTL time.Duration
+}
+
+// setTokenCookies sets the access and refresh tokens and a new CSRF token.
+func (h *handler) setTokenCookies(w http.ResponseWriter, tokens entity.Tokens) error {
+	b := make([]byte, csrfTokenLength)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("error to generate csrf token: %w", err)
+	}
+
+	h.setCookie(w, accessCookie, tokens.AccessToken, "/", int(tokens.ExpiresIn), true)
+	h.setCookie(w, refreshCookie, tokens.RefreshToken, refreshCookiePath, int(h.cookies.refreshTTL.Seconds()), true)
+	h.setCookie(w, csrfCookie, base64.RawURLEncoding.EncodeToString(b), "/", int(h.cookies.refreshTTL.Seconds()), false)
+
+	return nil
+}
+
+func (h *handler) clearTokenCookies(w http.ResponseWriter) {
+	h.setCookie(w, accessCookie, "", "/", -1, true)
+	h.setCookie(w, refreshCookie, "", refreshCookiePath, -1, true)
+	h.setCookie(w, csrfCookie, "", "/", -1, false)
+}
+
+func (h *handler) setCookie(w http.ResponseWriter, name, value, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		HttpOnly: httpOnly,
+		Secure:   h.cookies.secure,
+		SameSite: h.cookies.sameSite,
+	})
+}
+
+// validCSRF checks the double-submit CSRF token: the header must match the cookie.
+func validCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	header := r.Header.Get(csrfHeader)
+
+	return subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) == 1
+}
+
+// isSafeMethod reports methods that don't change state and so don't need the CSRF token.
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
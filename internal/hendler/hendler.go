@@ -4,13 +4,25 @@ import (
 	"net/http"
 
 	"github.com/IgorAleksandroff/gophermart/internal/usecase"
+	"github.com/IgorAleksandroff/gophermart/pkg/jwtkeys"
 	"github.com/IgorAleksandroff/gophermart/pkg/logger"
 )
 
 type handler struct {
-	ordersUC usecase.Orders
-	auth     usecase.Authorization
-	l        *logger.Logger
+	ordersUC   usecase.Orders
+	auth       usecase.Authorization
+	passwords  usecase.PasswordReset
+	loginGuard usecase.LoginGuard
+	admin      usecase.Admin
+	apiKeys    usecase.APIKeys
+	publicKey  publicKeys
+	l          *logger.Logger
+	// cookies is nil unless the cookie mode is on
+	cookies *cookieConfig
+}
+
+type publicKeys interface {
+	JWKS() []jwtkeys.JWK
 }
 
 type handlerFunc interface {
@@ -20,13 +32,30 @@ type handlerFunc interface {
 func New(
 	ordersUC usecase.Orders,
 	auth usecase.Authorization,
+	passwords usecase.PasswordReset,
+	loginGuard usecase.LoginGuard,
+	admin usecase.Admin,
+	apiKeys usecase.APIKeys,
+	publicKey publicKeys,
 	l *logger.Logger,
+	opts ...Option,
 ) *handler {
-	return &handler{
-		ordersUC: ordersUC,
-		auth:     auth,
-		l:        l,
+	h := &handler{
+		ordersUC:   ordersUC,
+		auth:       auth,
+		passwords:  passwords,
+		loginGuard: loginGuard,
+		admin:      admin,
+		apiKeys:    apiKeys,
+		publicKey:  publicKey,
+		l:          l,
 	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	return h
 }
 
 func (h *handler) Register(router handlerFunc, method, path string, handler http.HandlerFunc) {
@@ -2,10 +2,13 @@ package hendler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,39 +16,73 @@ import (
 	"github.com/IgorAleksandroff/gophermart/internal/entity"
 	"github.com/IgorAleksandroff/gophermart/internal/repository"
 	"github.com/IgorAleksandroff/gophermart/internal/usecase"
+	"github.com/IgorAleksandroff/gophermart/pkg/jwtkeys"
+	"github.com/go-chi/chi"
 )
 
 const (
 	authorizationHeader = "Authorization"
 	userCtx             = "login"
+	orderNumberParam    = "number"
+
+	defaultLedgerLimit = 50
+	maxLedgerLimit     = 500
+
+	maxOrdersBatch = 1000
 )
 
+type identityCtxKey struct{}
+
 func (h *handler) UserIdentity(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get(authorizationHeader)
-
-		if header == "" {
-			http.Error(w, "empty auth header", http.StatusUnauthorized)
+		token, fromCookie, err := h.accessToken(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		headerParts := strings.Split(header, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			http.Error(w, "invalid auth header", http.StatusUnauthorized)
+		if fromCookie && !isSafeMethod(r.Method) && !validCSRF(r) {
+			http.Error(w, "invalid csrf token", http.StatusForbidden)
 			return
 		}
 
-		login, err := h.auth.ParseToken(headerParts[1])
+		identity, err := h.auth.Identify(r.Context(), token)
 		if err != nil {
+			if errors.Is(err, usecase.ErrUserBlocked) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		r.Header.Set(userCtx, login)
-		next.ServeHTTP(w, r)
+		r.Header.Set(userCtx, identity.Login)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityCtxKey{}, identity)))
 	})
 }
 
+// accessToken takes the token from the Authorization header, in the cookie mode from the cookie if there is
+// no header. Only a token from the cookie is sent by the browser by itself, so only it needs the CSRF check.
+func (h *handler) accessToken(r *http.Request) (string, bool, error) {
+	header := r.Header.Get(authorizationHeader)
+
+	if header == "" {
+		if h.cookies != nil {
+			if cookie, err := r.Cookie(accessCookie); err == nil && cookie.Value != "" {
+				return cookie.Value, true, nil
+			}
+		}
+		return "", false, errors.New("empty auth header")
+	}
+
+	headerParts := strings.Split(header, " ")
+	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		return "", false, errors.New("invalid auth header")
+	}
+
+	return headerParts[1], false, nil
+}
+
 func (h *handler) HandleUserRegister(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -72,6 +109,11 @@ func (h *handler) HandleUserRegister(w http.ResponseWriter, r *http.Request) {
 
 	if err := h.auth.CreateUser(ctx, newUser); err != nil {
 		h.l.Warn(err.Error())
+		var validationErr *usecase.ValidationError
+		if errors.As(err, &validationErr) {
+			h.writeValidationError(w, validationErr)
+			return
+		}
 		if errors.Is(err, repository.ErrUserRegister) {
 			http.Error(w, err.Error(), http.StatusConflict)
 			return
@@ -81,15 +123,14 @@ func (h *handler) HandleUserRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.auth.GenerateToken(ctx, newUser.Login, newUser.Password)
+	tokens, err := h.auth.GenerateToken(ctx, newUser.Login, newUser.Password)
 	if err != nil {
 		h.l.Warn(err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set(authorizationHeader, fmt.Sprintf("Bearer %s", token))
-	w.WriteHeader(http.StatusOK)
+	h.writeTokens(w, tokens)
 }
 
 func (h *handler) HandleUserLogin(w http.ResponseWriter, r *http.Request) {
@@ -113,22 +154,281 @@ func (h *handler) HandleUserLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.auth.GenerateToken(ctx, user.Login, user.Password)
+	ip := clientIP(r)
+	if err := h.loginGuard.Attempt(ctx, user.Login, ip); err != nil {
+		var lockedErr *usecase.LoginLockedError
+		if errors.As(err, &lockedErr) {
+			h.l.Warn("login %s from %s: %s", user.Login, ip, err.Error())
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tokens, err := h.auth.GenerateToken(ctx, user.Login, user.Password)
 	if err != nil {
 		errLogin := errors.Is(err, usecase.ErrUserLogin) || errors.Is(err, repository.ErrUserLogin)
 		if errLogin {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
+		if errors.Is(err, usecase.ErrUserBlocked) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err = h.loginGuard.Succeeded(ctx, user.Login, ip); err != nil {
+		h.l.Warn("can't reset failed logins of %s: %s", user.Login, err.Error())
+	}
+
+	h.writeTokens(w, tokens)
+}
+
+// HandleTokenRefresh takes the refresh token from the JSON body, in the cookie mode from the cookie
+// if the body isn't JSON.
+func (h *handler) HandleTokenRefresh(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	contentTypeHeaderValue := r.Header.Get("Content-Type")
+	isJSON := strings.Contains(contentTypeHeaderValue, "application/json")
+
+	var refreshToken string
+	if cookie, err := r.Cookie(refreshCookie); h.cookies != nil && !isJSON && err == nil {
+		if !validCSRF(r) {
+			http.Error(w, "invalid csrf token", http.StatusForbidden)
+			return
+		}
+		refreshToken = cookie.Value
+	} else {
+		if !isJSON {
+			http.Error(w, "unknown content-type", http.StatusBadRequest)
+			return
+		}
+
+		if r.Body == nil {
+			http.Error(w, "empty body", http.StatusBadRequest)
+			return
+		}
+
+		request := struct {
+			RefreshToken string `json:"refresh_token"`
+		}{}
+		reader := json.NewDecoder(r.Body)
+		if err := reader.Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		refreshToken = request.RefreshToken
+	}
+
+	tokens, err := h.auth.RefreshToken(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidRefreshToken) || errors.Is(err, usecase.ErrRefreshTokenReused) {
+			h.l.Warn(err.Error())
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if errors.Is(err, usecase.ErrUserBlocked) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeTokens(w, tokens)
+}
+
+// HandleLogout revokes the access token of the request and the refresh tokens of its session.
+func (h *handler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	identity, ok := ctx.Value(identityCtxKey{}).(entity.Identity)
+	if !ok {
+		http.Error(w, "unknown user", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.auth.Logout(ctx, identity); err != nil {
+		h.l.Warn(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if h.cookies != nil {
+		h.clearTokenCookies(w)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleLogoutAll revokes all tokens of the user on every device.
+func (h *handler) HandleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := h.auth.LogoutAll(ctx, r.Header.Get(userCtx)); err != nil {
+		h.l.Warn(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if h.cookies != nil {
+		h.clearTokenCookies(w)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleChangePassword sets a new password, all other sessions of the user are revoked.
+func (h *handler) HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	contentTypeHeaderValue := r.Header.Get("Content-Type")
+	if !strings.Contains(contentTypeHeaderValue, "application/json") {
+		http.Error(w, "unknown content-type", http.StatusBadRequest)
+		return
+	}
+
+	if r.Body == nil {
+		http.Error(w, "empty body", http.StatusBadRequest)
+		return
+	}
+
+	request := struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}{}
+	reader := json.NewDecoder(r.Body)
+	if err := reader.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := h.auth.ChangePassword(ctx, r.Header.Get(userCtx), request.OldPassword, request.NewPassword)
+	if err != nil {
+		h.l.Warn(err.Error())
+		var validationErr *usecase.ValidationError
+		if errors.As(err, &validationErr) {
+			h.writeValidationError(w, validationErr)
+			return
+		}
+		if errors.Is(err, usecase.ErrWrongPassword) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeTokens(w, tokens)
+}
+
+// HandleResetPassword sets a new password by a reset token, the user has to log in again after it.
+func (h *handler) HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	contentTypeHeaderValue := r.Header.Get("Content-Type")
+	if !strings.Contains(contentTypeHeaderValue, "application/json") {
+		http.Error(w, "unknown content-type", http.StatusBadRequest)
+		return
+	}
+
+	if r.Body == nil {
+		http.Error(w, "empty body", http.StatusBadRequest)
+		return
+	}
+
+	request := struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}{}
+	reader := json.NewDecoder(r.Body)
+	if err := reader.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.passwords.ResetPassword(ctx, request.Token, request.NewPassword); err != nil {
+		h.l.Warn(err.Error())
+		var validationErr *usecase.ValidationError
+		if errors.As(err, &validationErr) {
+			h.writeValidationError(w, validationErr)
+			return
+		}
+		if errors.Is(err, usecase.ErrInvalidResetToken) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
 
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set(authorizationHeader, fmt.Sprintf("Bearer %s", token))
 	w.WriteHeader(http.StatusOK)
 }
 
+// writeTokens sets the access token to the Authorization header and returns both tokens in the body,
+// in the cookie mode it sets the token cookies too.
+func (h *handler) writeTokens(w http.ResponseWriter, tokens entity.Tokens) {
+	buf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(buf)
+	if err := jsonEncoder.Encode(tokens); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if h.cookies != nil {
+		if err := h.setTokenCookies(w, tokens); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set(authorizationHeader, fmt.Sprintf("Bearer %s", tokens.AccessToken))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// writeValidationError answers 400 with the message of every invalid field.
+func (h *handler) writeValidationError(w http.ResponseWriter, validationErr *usecase.ValidationError) {
+	buf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(buf)
+	if err := jsonEncoder.Encode(validationErr); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(buf.Bytes())
+}
+
+// HandleGetJWKS publishes the public token keys, so other services can verify tokens by themselves.
+func (h *handler) HandleGetJWKS(w http.ResponseWriter, r *http.Request) {
+	buf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(buf)
+	err := jsonEncoder.Encode(struct {
+		Keys []jwtkeys.JWK `json:"keys"`
+	}{Keys: h.publicKey.JWKS()})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
 func (h *handler) HandlePostOrders(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
@@ -149,21 +449,17 @@ func (h *handler) HandlePostOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order := string(b)
-	orderNumber, err := strconv.Atoi(order)
+	order, err := entity.NormalizeOrderNumber(string(b))
 	if err != nil {
+		h.l.Warn(err.Error())
 		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
-	if !entity.Valid(orderNumber) {
-		h.l.Warn("invalid order number: %v", orderNumber)
-		http.Error(w, "invalid order number ", http.StatusUnprocessableEntity)
-		return
-	}
 
-	err = h.ordersUC.SaveOrder(ctx, entity.Order{
+	err = h.ordersUC.RegisterOrder(ctx, entity.Order{
 		OrderID:   order,
 		UserLogin: r.Header.Get(userCtx),
+		APIKeyID:  actingAPIKeyID(r),
 	})
 	if err != nil {
 		h.l.Warn(err.Error())
@@ -183,10 +479,88 @@ func (h *handler) HandlePostOrders(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// HandlePostOrdersBatch uploads orders given as a JSON array or a newline delimited text list and returns
+// the result of every number, so one invalid or conflicting number doesn't fail the whole batch.
+func (h *handler) HandlePostOrdersBatch(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Body == nil {
+		http.Error(w, "empty body", http.StatusBadRequest)
+		return
+	}
+
+	var numbers []string
+	contentTypeHeaderValue := r.Header.Get("Content-Type")
+	switch {
+	case strings.Contains(contentTypeHeaderValue, "application/json"):
+		var items []json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, item := range items {
+			// numbers are taken as they're written, so a long number doesn't lose digits in a float
+			var number string
+			if err := json.Unmarshal(item, &number); err != nil {
+				number = string(item)
+			}
+			numbers = append(numbers, strings.TrimSpace(number))
+		}
+	case strings.Contains(contentTypeHeaderValue, "text/plain"):
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if number := strings.TrimSpace(line); number != "" {
+				numbers = append(numbers, number)
+			}
+		}
+	default:
+		http.Error(w, "unknown content-type", http.StatusBadRequest)
+		return
+	}
+
+	if len(numbers) == 0 {
+		http.Error(w, "empty batch", http.StatusBadRequest)
+		return
+	}
+	if len(numbers) > maxOrdersBatch {
+		http.Error(w, fmt.Sprintf("batch must have at most %d orders", maxOrdersBatch), http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.ordersUC.RegisterOrders(ctx, r.Header.Get(userCtx), actingAPIKeyID(r), numbers)
+	if err != nil {
+		h.l.Warn(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(buf)
+	if err = jsonEncoder.Encode(results); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// HandleGetOrders returns a page of the user orders, oldest first, see listFilter for the query.
 func (h *handler) HandleGetOrders(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	orders, err := h.ordersUC.GetOrders(ctx, r.Header.Get(userCtx))
+	filter, err := listFilter(r, true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	orders, next, err := h.ordersUC.GetOrders(ctx, r.Header.Get(userCtx), filter)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -205,6 +579,37 @@ func (h *handler) HandleGetOrders(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if next != "" {
+		w.Header().Set(nextCursorHeader, next)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// HandleGetOrder returns the user order with its status timeline, orders of other users are not found.
+func (h *handler) HandleGetOrder(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	order, err := h.ordersUC.GetOrderDetails(ctx, r.Header.Get(userCtx), chi.URLParam(r, orderNumberParam))
+	if err != nil {
+		if errors.Is(err, usecase.ErrUnknownOrder) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		h.l.Warn(err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(buf)
+	if err = jsonEncoder.Encode(order); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(buf.Bytes())
@@ -258,13 +663,14 @@ func (h *handler) HandlePostBalanceWithdraw(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	orderNumber, err := strconv.Atoi(withdrawal.OrderID)
+	orderNumber, err := entity.NormalizeOrderNumber(withdrawal.OrderID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
-	if !entity.Valid(orderNumber) {
-		http.Error(w, "invalid withdrawal number ", http.StatusUnprocessableEntity)
+	withdrawal.OrderID = orderNumber
+	if withdrawal.Value <= 0 {
+		http.Error(w, "withdrawal sum must be positive", http.StatusUnprocessableEntity)
 		return
 	}
 
@@ -275,6 +681,14 @@ func (h *handler) HandlePostBalanceWithdraw(w http.ResponseWriter, r *http.Reque
 			http.Error(w, err.Error(), http.StatusPaymentRequired)
 			return
 		}
+		if errors.Is(err, usecase.ErrWithdrawalExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, repository.ErrUserLogin) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
 
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -283,10 +697,17 @@ func (h *handler) HandlePostBalanceWithdraw(w http.ResponseWriter, r *http.Reque
 	w.WriteHeader(http.StatusOK)
 }
 
+// HandleGetWithdrawals returns a page of the user withdrawals, oldest first, see listFilter for the query.
 func (h *handler) HandleGetWithdrawals(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	orders, err := h.ordersUC.GetWithdrawals(ctx, r.Header.Get(userCtx))
+	filter, err := listFilter(r, false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	orders, next, err := h.ordersUC.GetWithdrawals(ctx, r.Header.Get(userCtx), filter)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -305,7 +726,68 @@ func (h *handler) HandleGetWithdrawals(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if next != "" {
+		w.Header().Set(nextCursorHeader, next)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(buf.Bytes())
 }
+
+func (h *handler) HandleGetLedger(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	limit, err := queryInt(r, "limit", defaultLedgerLimit)
+	if err != nil || limit <= 0 || limit > maxLedgerLimit {
+		http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxLedgerLimit), http.StatusBadRequest)
+		return
+	}
+
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		http.Error(w, "offset must be a non-negative number", http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.ordersUC.GetLedger(ctx, r.Header.Get(userCtx), limit, offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(entries) == 0 {
+		http.Error(w, "empty slice", http.StatusNoContent)
+		return
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	jsonEncoder := json.NewEncoder(buf)
+	err = jsonEncoder.Encode(entries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// clientIP is the address of the direct peer, proxy headers aren't trusted as they're set by the client.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func queryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	return strconv.Atoi(value)
+}
@@ -0,0 +1,297 @@
+package hendler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+	"github.com/IgorAleksandroff/gophermart/internal/notifier"
+	"github.com/IgorAleksandroff/gophermart/internal/repository"
+	"github.com/IgorAleksandroff/gophermart/internal/usecase"
+	"github.com/IgorAleksandroff/gophermart/internal/webapi"
+	"github.com/IgorAleksandroff/gophermart/pkg/breached"
+	"github.com/IgorAleksandroff/gophermart/pkg/jwtkeys"
+	"github.com/IgorAleksandroff/gophermart/pkg/logger"
+	"github.com/go-chi/chi"
+)
+
+const testPassword = "correct horse"
+
+// plainHasher keeps the handler tests fast, the real hashing is tested in pkg/hasher.
+type plainHasher struct{}
+
+func (plainHasher) Hash(password string) (string, error) {
+	return "plain:" + password, nil
+}
+
+func (plainHasher) Compare(hash, password string) (bool, error) {
+	return hash == "plain:"+password, nil
+}
+
+func (plainHasher) NeedsRehash(hash string) bool {
+	return false
+}
+
+type ledgerReader interface {
+	GetLedger(ctx context.Context, login string, limit, offset int) ([]entity.LedgerEntry, error)
+}
+
+// testEnv is the handler over the in-memory repository with the routes of the app.
+type testEnv struct {
+	router  chi.Router
+	admin   usecase.Admin
+	apiKeys usecase.APIKeys
+	ledger  ledgerReader
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	l := logger.New("error")
+	repo := repository.NewMemoRepository(context.Background(), l)
+
+	policy, err := usecase.NewCredentialsPolicy(3, 64, `^[a-zA-Z0-9._-]+$`, 8, breached.Bundled())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenKeys, err := jwtkeys.FromSecret("test", strings.Repeat("s", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := &testEnv{
+		router:  chi.NewRouter(),
+		admin:   usecase.NewAdmin(repo),
+		apiKeys: usecase.NewAPIKeys(repo),
+		ledger:  repo,
+	}
+	h := New(
+		usecase.NewOrders(repo, webapi.NewAccrualClient("http://localhost:0")),
+		usecase.NewAuthorization(repo, plainHasher{}, policy, tokenKeys, time.Hour, time.Hour, l),
+		usecase.NewPasswordReset(repo, plainHasher{}, policy, notifier.NewDiscard(l), time.Hour),
+		usecase.NewLoginGuard(repo, 0, 0, time.Minute, time.Minute),
+		env.admin,
+		env.apiKeys,
+		tokenKeys,
+		l,
+	)
+
+	r := env.router
+	h.Register(r, http.MethodPost, "/api/user/register", h.HandleUserRegister)
+	h.Register(r, http.MethodPost, "/api/user/login", h.HandleUserLogin)
+
+	r.Group(func(r chi.Router) {
+		r.Use(h.UserIdentity)
+		h.Register(r, http.MethodPost, "/api/user/orders", h.HandlePostOrders)
+		h.Register(r, http.MethodPost, "/api/user/orders/batch", h.HandlePostOrdersBatch)
+		h.Register(r, http.MethodGet, "/api/user/orders", h.HandleGetOrders)
+		h.Register(r, http.MethodGet, "/api/user/balance", h.HandleGetBalance)
+	})
+
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(h.UserIdentity, h.RequireRole(entity.RoleAdmin))
+		h.Register(r, http.MethodGet, "/users/{login}", h.HandleAdminGetUser)
+		h.Register(r, http.MethodPost, "/users/{login}/adjustments", h.HandleAdminAdjustBalance)
+	})
+
+	r.Route("/api/partner/users/{login}", func(r chi.Router) {
+		r.Use(h.APIKeyIdentity)
+		r.Group(func(r chi.Router) {
+			r.Use(h.RequireScope(entity.ScopeOrdersWrite))
+			h.Register(r, http.MethodPost, "/orders", h.HandlePostOrders)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(h.RequireScope(entity.ScopeBalanceRead))
+			h.Register(r, http.MethodGet, "/balance", h.HandleGetBalance)
+		})
+	})
+
+	return env
+}
+
+// do serves the request, the header values are set as is, e.g. "Authorization": "Bearer <token>".
+func (e *testEnv) do(t *testing.T, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	for name, value := range header {
+		r.Header.Set(name, value)
+	}
+
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, r)
+
+	return w
+}
+
+// register creates the user and returns the authorization header of the user.
+func (e *testEnv) register(t *testing.T, login string) map[string]string {
+	t.Helper()
+	return e.authorize(t, "/api/user/register", login)
+}
+
+// login logs the user in again, e.g. to get the granted roles in the token.
+func (e *testEnv) login(t *testing.T, login string) map[string]string {
+	t.Helper()
+	return e.authorize(t, "/api/user/login", login)
+}
+
+func (e *testEnv) authorize(t *testing.T, path, login string) map[string]string {
+	t.Helper()
+
+	body, err := json.Marshal(entity.User{Login: login, Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := e.do(t, http.MethodPost, path, string(body), map[string]string{"Content-Type": "application/json"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s %s: %d %s", path, login, w.Code, w.Body.String())
+	}
+
+	return map[string]string{authorizationHeader: w.Header().Get(authorizationHeader)}
+}
+
+func TestHandleUserRegisterValidationError(t *testing.T) {
+	env := newTestEnv(t)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantFields []string
+	}{
+		{name: "both fields", body: `{"login":"","password":""}`, wantFields: []string{"login", "password"}},
+		{name: "login pattern", body: `{"login":"bad login","password":"correct horse"}`, wantFields: []string{"login"}},
+		{name: "breached password", body: `{"login":"alice","password":"password"}`, wantFields: []string{"password"}},
+		{name: "password over 72 bytes", body: `{"login":"alice","password":"` + strings.Repeat("x", 73) + `"}`,
+			wantFields: []string{"password"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := env.do(t, http.MethodPost, "/api/user/register", tt.body, map[string]string{"Content-Type": "application/json"})
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400: %s", w.Code, w.Body.String())
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", contentType)
+			}
+
+			var response struct {
+				Errors map[string]string `json:"errors"`
+			}
+			if err := json.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(&response); err != nil {
+				t.Fatalf("decode %q: %v", w.Body.String(), err)
+			}
+			if len(response.Errors) != len(tt.wantFields) {
+				t.Errorf("errors = %v, want the fields %v", response.Errors, tt.wantFields)
+			}
+			for _, field := range tt.wantFields {
+				if response.Errors[field] == "" {
+					t.Errorf("no message for %s in %v", field, response.Errors)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlePostOrdersBatch(t *testing.T) {
+	env := newTestEnv(t)
+
+	bob := env.register(t, "bob")
+	bob["Content-Type"] = "text/plain"
+	if w := env.do(t, http.MethodPost, "/api/user/orders", "79927398713", bob); w.Code != http.StatusAccepted {
+		t.Fatalf("order of bob: status = %d, want 202: %s", w.Code, w.Body.String())
+	}
+
+	alice := env.register(t, "alice")
+	alice["Content-Type"] = "text/plain"
+
+	tooLong := "1" + strings.Repeat("0", 64)
+	body := strings.Join([]string{tooLong, tooLong, "12345678903", "12345678903", "12345678904", "79927398713"}, "\n")
+	w := env.do(t, http.MethodPost, "/api/user/orders/batch", body, alice)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+
+	var results []entity.OrderUploadResult
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	want := []string{
+		entity.UploadTooLong,
+		entity.UploadTooLong,
+		entity.UploadAccepted,
+		entity.UploadAlreadyUploaded,
+		entity.UploadInvalid,
+		entity.UploadConflict,
+	}
+	if len(results) != len(want) {
+		t.Fatalf("results = %+v, want %v", results, want)
+	}
+	for i, result := range results {
+		if result.Result != want[i] {
+			t.Errorf("result %d of %q = %s, want %s", i, result.Number, result.Result, want[i])
+		}
+	}
+}
+
+func TestHandleGetOrdersPages(t *testing.T) {
+	env := newTestEnv(t)
+
+	header := env.register(t, "alice")
+	header["Content-Type"] = "text/plain"
+	// uploaded in the list order: by the time and by the number within a second
+	numbers := []string{"12345678903", "4561261212345467", "79927398713"}
+	for _, number := range numbers {
+		if w := env.do(t, http.MethodPost, "/api/user/orders", number, header); w.Code != http.StatusAccepted {
+			t.Fatalf("upload %s: status = %d, want 202: %s", number, w.Code, w.Body.String())
+		}
+	}
+
+	page := func(query string) ([]string, string) {
+		t.Helper()
+
+		w := env.do(t, http.MethodGet, "/api/user/orders"+query, "", header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, want 200: %s", query, w.Code, w.Body.String())
+		}
+
+		var orders []entity.Orders
+		if err := json.Unmarshal(w.Body.Bytes(), &orders); err != nil {
+			t.Fatalf("decode %q: %v", w.Body.String(), err)
+		}
+		got := make([]string, 0, len(orders))
+		for _, order := range orders {
+			got = append(got, order.OrderID)
+		}
+
+		return got, w.Header().Get(nextCursorHeader)
+	}
+
+	all, next := page("")
+	if strings.Join(all, ",") != strings.Join(numbers, ",") || next != "" {
+		t.Errorf("without a limit = %v, cursor %q, want all of %v oldest first and no cursor", all, next, numbers)
+	}
+
+	first, next := page("?limit=2")
+	if strings.Join(first, ",") != strings.Join(numbers[:2], ",") || next == "" {
+		t.Fatalf("first page = %v, cursor %q, want %v and a cursor", first, next, numbers[:2])
+	}
+	last, next := page("?limit=2&cursor=" + next)
+	if strings.Join(last, ",") != strings.Join(numbers[2:], ",") || next != "" {
+		t.Errorf("last page = %v, cursor %q, want %v and no cursor", last, next, numbers[2:])
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=501", "?limit=x"} {
+		if w := env.do(t, http.MethodGet, "/api/user/orders"+query, "", header); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
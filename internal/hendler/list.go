@@ -0,0 +1,89 @@
+package hendler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+)
+
+const (
+	maxListLimit = 500
+
+	// nextCursorHeader carries the cursor of the next page, it's absent on the last page.
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+var orderStatuses = map[string]struct{}{
+	entity.StatusNew:        {},
+	entity.StatusProcessing: {},
+	entity.StatusInvalid:    {},
+	entity.StatusProcessed:  {},
+}
+
+// listFilter reads the page query of the orders and withdrawals lists: limit, cursor, from and to in RFC 3339
+// and, for orders only, status repeated or comma separated. Without a limit the whole list is returned,
+// as before the pagination, so the clients that don't know about it get all the items.
+func listFilter(r *http.Request, withStatus bool) (entity.ListFilter, error) {
+	query := r.URL.Query()
+
+	var filter entity.ListFilter
+	if query.Get("limit") != "" {
+		limit, err := queryInt(r, "limit", 0)
+		if err != nil || limit <= 0 || limit > maxListLimit {
+			return entity.ListFilter{}, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := entity.ParseCursor(value)
+		if err != nil {
+			return entity.ListFilter{}, err
+		}
+		filter.Cursor = &cursor
+	}
+
+	var err error
+	if filter.From, err = queryTime(r, "from"); err != nil {
+		return entity.ListFilter{}, err
+	}
+	if filter.To, err = queryTime(r, "to"); err != nil {
+		return entity.ListFilter{}, err
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return entity.ListFilter{}, errors.New("from must be before to")
+	}
+
+	for _, value := range query["status"] {
+		if !withStatus {
+			return entity.ListFilter{}, errors.New("status filter isn't supported by the list")
+		}
+		for _, status := range strings.Split(value, ",") {
+			status = strings.ToUpper(strings.TrimSpace(status))
+			if _, ok := orderStatuses[status]; !ok {
+				return entity.ListFilter{}, fmt.Errorf("unknown order status %q", status)
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	return filter, nil
+}
+
+func queryTime(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be a time in RFC 3339 format", name)
+	}
+
+	return t, nil
+}
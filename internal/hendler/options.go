@@ -0,0 +1,21 @@
+package hendler
+
+import (
+	"net/http"
+	"time"
+)
+
+type Option func(*handler)
+
+// CookieMode makes register, login and refresh set the tokens in HttpOnly cookies too, so browser clients
+// don't keep them in scripts. Requests authenticated by the cookie are protected with a double-submit CSRF token.
+// secure must be false only for local development over plain http.
+func CookieMode(secure bool, sameSite http.SameSite, refreshTTL time.Duration) Option {
+	return func(h *handler) {
+		h.cookies = &cookieConfig{
+			secure:     secure,
+			sameSite:   sameSite,
+			refreshTTL: refreshTTL,
+		}
+	}
+}
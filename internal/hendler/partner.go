@@ -0,0 +1,89 @@
+package hendler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+	"github.com/IgorAleksandroff/gophermart/internal/repository"
+	"github.com/IgorAleksandroff/gophermart/internal/usecase"
+	"github.com/go-chi/chi"
+)
+
+const apiKeyHeader = "X-Api-Key"
+
+type apiKeyCtxKey struct{}
+
+// APIKeyIdentity authenticates a partner service by the X-Api-Key header and makes the user
+// of the {login} URL parameter the user of the request, so the user handlers act on behalf of them.
+func (h *handler) APIKeyIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		header := r.Header.Get(apiKeyHeader)
+		if header == "" {
+			http.Error(w, "empty api key header", http.StatusUnauthorized)
+			return
+		}
+
+		key, err := h.apiKeys.Authenticate(ctx, header)
+		if err != nil {
+			if errors.Is(err, usecase.ErrInvalidAPIKey) {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		login := chi.URLParam(r, loginParam)
+		user, err := h.ordersUC.GetUser(ctx, login)
+		if err != nil {
+			if errors.Is(err, repository.ErrUserLogin) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user.BlockedAt != nil {
+			http.Error(w, usecase.ErrUserBlocked.Error(), http.StatusForbidden)
+			return
+		}
+
+		h.l.Debug("api key %s acts on behalf of %s: %s %s", key.ID, login, r.Method, r.URL.Path)
+
+		r.Header.Set(userCtx, login)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, apiKeyCtxKey{}, key)))
+	})
+}
+
+// RequireScope lets through only API keys with the scope, it must follow APIKeyIdentity.
+func (h *handler) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := r.Context().Value(apiKeyCtxKey{}).(entity.APIKey)
+			if !ok {
+				http.Error(w, "unknown api key", http.StatusUnauthorized)
+				return
+			}
+
+			if !key.HasScope(scope) {
+				h.l.Warn("api key %s without scope %s requested %s", key.ID, scope, r.URL.Path)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// actingAPIKeyID is the id of the API key the request is made with, empty for user requests.
+func actingAPIKeyID(r *http.Request) string {
+	key, _ := r.Context().Value(apiKeyCtxKey{}).(entity.APIKey)
+	return key.ID
+}
@@ -0,0 +1,41 @@
+package hendler
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+)
+
+func TestPartnerAPIKeyScopes(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t)
+	env.register(t, "alice")
+
+	apiKey, key, err := env.apiKeys.Create(ctx, "partner", []string{entity.ScopeBalanceRead}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := map[string]string{apiKeyHeader: key, "Content-Type": "text/plain"}
+
+	if w := env.do(t, http.MethodGet, "/api/partner/users/alice/balance", "", header); w.Code != http.StatusOK {
+		t.Errorf("key within its scope: status = %d, want 200: %s", w.Code, w.Body.String())
+	}
+	if w := env.do(t, http.MethodPost, "/api/partner/users/alice/orders", "12345678903", header); w.Code != http.StatusForbidden {
+		t.Errorf("key outside its scope: status = %d, want 403: %s", w.Code, w.Body.String())
+	}
+
+	if err = env.apiKeys.Revoke(ctx, apiKey.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := env.do(t, http.MethodGet, "/api/partner/users/alice/balance", "", header); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: status = %d, want 401: %s", w.Code, w.Body.String())
+	}
+
+	header[apiKeyHeader] = key + "x"
+	if w := env.do(t, http.MethodGet, "/api/partner/users/alice/balance", "", header); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown key: status = %d, want 401: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,284 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+const (
+	// lockID serializes migrations between several replicas started at the same time.
+	lockID = 7482391001
+
+	upSuffix   = ".up.sql"
+	downSuffix = ".down.sql"
+
+	queryCreateMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(128) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`
+	queryLock             = `SELECT pg_advisory_xact_lock($1)`
+	queryGetApplied       = `SELECT version, name, applied_at FROM schema_migrations ORDER BY version`
+	queryIsApplied        = `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`
+	querySaveMigration    = `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+	queryDeleteMigration  = `DELETE FROM schema_migrations WHERE version = $1`
+	queryGetLastMigration = `SELECT version FROM schema_migrations ORDER BY version DESC LIMIT 1`
+)
+
+var ErrUnknownCommand = errors.New("unknown migrate command, expected up, down or status")
+
+type Migration struct {
+	Version   int
+	Name      string
+	Up        string
+	Down      string
+	AppliedAt *time.Time
+}
+
+// Run executes one of the migrate subcommands: up, down or status.
+func Run(ctx context.Context, db *sqlx.DB, command string) (string, error) {
+	switch command {
+	case "up":
+		applied, err := Up(ctx, db)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("applied %d migration(s)\n", applied), nil
+	case "down":
+		version, err := Down(ctx, db)
+		if err != nil {
+			return "", err
+		}
+		if version == 0 {
+			return "nothing to roll back\n", nil
+		}
+		return fmt.Sprintf("rolled back migration %04d\n", version), nil
+	case "status":
+		migrations, err := Status(ctx, db)
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		for _, m := range migrations {
+			status, appliedAt := "pending", ""
+			if m.AppliedAt != nil {
+				status, appliedAt = "applied", m.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(&b, "%04d %-32s %-8s %s\n", m.Version, m.Name, status, appliedAt)
+		}
+		return b.String(), nil
+	}
+
+	return "", ErrUnknownCommand
+}
+
+// Up applies all pending migrations in order, each one in its own transaction.
+func Up(ctx context.Context, db *sqlx.DB) (int, error) {
+	migrations, err := load()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = db.ExecContext(ctx, queryCreateMigrationsTable); err != nil {
+		return 0, fmt.Errorf("error to create schema_migrations: %w", err)
+	}
+
+	var applied int
+	for _, m := range migrations {
+		ok, err := apply(ctx, db, m)
+		if err != nil {
+			return applied, fmt.Errorf("error to apply migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+		if ok {
+			applied++
+		}
+	}
+
+	return applied, nil
+}
+
+// Down rolls back the last applied migration and returns its version, or 0 if nothing is applied.
+func Down(ctx context.Context, db *sqlx.DB) (int, error) {
+	migrations, err := load()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err = db.ExecContext(ctx, queryCreateMigrationsTable); err != nil {
+		return 0, fmt.Errorf("error to create schema_migrations: %w", err)
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, queryLock, lockID); err != nil {
+		return 0, fmt.Errorf("error to lock migrations: %w", err)
+	}
+
+	var version int
+	if err = tx.GetContext(ctx, &version, queryGetLastMigration); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("error to get last migration: %w", err)
+	}
+
+	var m *Migration
+	for i := range migrations {
+		if migrations[i].Version == version {
+			m = &migrations[i]
+		}
+	}
+	if m == nil {
+		return 0, fmt.Errorf("unknown migration version %d", version)
+	}
+
+	if _, err = tx.ExecContext(ctx, m.Down); err != nil {
+		return 0, fmt.Errorf("error to roll back migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	if _, err = tx.ExecContext(ctx, queryDeleteMigration, m.Version); err != nil {
+		return 0, err
+	}
+
+	return version, tx.Commit()
+}
+
+// Status returns every known migration with the time it was applied, nil for pending ones.
+func Status(ctx context.Context, db *sqlx.DB) ([]Migration, error) {
+	migrations, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = db.ExecContext(ctx, queryCreateMigrationsTable); err != nil {
+		return nil, fmt.Errorf("error to create schema_migrations: %w", err)
+	}
+
+	var applied []struct {
+		Version   int       `db:"version"`
+		Name      string    `db:"name"`
+		AppliedAt time.Time `db:"applied_at"`
+	}
+	if err = db.SelectContext(ctx, &applied, queryGetApplied); err != nil {
+		return nil, fmt.Errorf("error to get applied migrations: %w", err)
+	}
+
+	for _, a := range applied {
+		appliedAt := a.AppliedAt
+		for i := range migrations {
+			if migrations[i].Version == a.Version {
+				migrations[i].AppliedAt = &appliedAt
+			}
+		}
+	}
+
+	return migrations, nil
+}
+
+func apply(ctx context.Context, db *sqlx.DB, m Migration) (bool, error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, queryLock, lockID); err != nil {
+		return false, fmt.Errorf("error to lock migrations: %w", err)
+	}
+
+	var applied bool
+	if err = tx.GetContext(ctx, &applied, queryIsApplied, m.Version); err != nil {
+		return false, err
+	}
+	if applied {
+		return false, nil
+	}
+
+	if _, err = tx.ExecContext(ctx, m.Up); err != nil {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, querySaveMigration, m.Version, m.Name); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// load reads the embedded NNNN_name.up.sql / NNNN_name.down.sql pairs sorted by version.
+func load() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		fileName := e.Name()
+
+		var body *string
+		var base string
+		switch {
+		case strings.HasSuffix(fileName, upSuffix):
+			base = strings.TrimSuffix(fileName, upSuffix)
+		case strings.HasSuffix(fileName, downSuffix):
+			base = strings.TrimSuffix(fileName, downSuffix)
+		default:
+			return nil, fmt.Errorf("invalid migration file name %q", fileName)
+		}
+
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid migration file name %q", fileName)
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration file name %q", fileName)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+
+		if strings.HasSuffix(fileName, upSuffix) {
+			body = &m.Up
+		} else {
+			body = &m.Down
+		}
+
+		content, err := files.ReadFile(path.Join("sql", fileName))
+		if err != nil {
+			return nil, err
+		}
+		*body = string(content)
+	}
+
+	result := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both up and down files", m.Version, m.Name)
+		}
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+
+	return result, nil
+}
@@ -0,0 +1,33 @@
+DO $$
+BEGIN
+    CREATE TYPE order_status AS ENUM (
+        'NEW',
+        'PROCESSING',
+        'INVALID',
+        'PROCESSED'
+    );
+EXCEPTION
+    WHEN duplicate_object THEN NULL;
+END $$;
+
+CREATE TABLE IF NOT EXISTS users (
+    login VARCHAR(64) PRIMARY KEY,
+    password VARCHAR(128) NOT NULL,
+    current DECIMAL(16, 4) NOT NULL DEFAULT 0,
+    withdrawn DECIMAL(16, 4) NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    order_id VARCHAR(64) PRIMARY KEY,
+    login VARCHAR(64) REFERENCES users(login),
+    status order_status,
+    accrual DECIMAL(16, 4) NOT NULL DEFAULT 0,
+    uploaded_at VARCHAR(32) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS orders_withdraws (
+    order_id VARCHAR(64) PRIMARY KEY,
+    login VARCHAR(64) REFERENCES users(login),
+    value DECIMAL(16, 4) NOT NULL DEFAULT 0,
+    processed_at VARCHAR(32) NOT NULL
+);
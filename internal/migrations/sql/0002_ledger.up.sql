@@ -0,0 +1,60 @@
+-- A cancelled balance change is booked as an ADJUSTMENT, there's no separate reversal type.
+CREATE TYPE ledger_entry_type AS ENUM (
+    'ACCRUAL',
+    'WITHDRAWAL',
+    'ADJUSTMENT'
+);
+
+CREATE SEQUENCE ledger_transaction_seq;
+
+-- Every balance change is one transaction of two entries that sum to zero:
+-- the user account ("user:<login>") and the matching system account ("system:<type>").
+CREATE TABLE ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id BIGINT NOT NULL,
+    account VARCHAR(80) NOT NULL,
+    login VARCHAR(64) NOT NULL REFERENCES users(login),
+    order_id VARCHAR(64),
+    type ledger_entry_type NOT NULL,
+    amount DECIMAL(16, 4) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ledger_entries_account_idx ON ledger_entries (account, id);
+CREATE INDEX ledger_entries_transaction_idx ON ledger_entries (transaction_id);
+
+CREATE FUNCTION ledger_entries_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger_entries is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_entries_append_only
+    BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_entries_append_only();
+
+-- Backfill the history known so far and reconcile it against the balance counters.
+CREATE TEMPORARY TABLE ledger_backfill ON COMMIT DROP AS
+    SELECT login, order_id, 'ACCRUAL'::ledger_entry_type AS type, accrual AS amount
+    FROM orders
+    WHERE accrual <> 0
+    UNION ALL
+    SELECT login, order_id, 'WITHDRAWAL'::ledger_entry_type, -value
+    FROM orders_withdraws
+    WHERE value <> 0;
+
+INSERT INTO ledger_backfill (login, order_id, type, amount)
+SELECT u.login, NULL, 'ADJUSTMENT', u.current - COALESCE(SUM(b.amount), 0)
+FROM users u
+    LEFT JOIN ledger_backfill b ON b.login = u.login
+GROUP BY u.login, u.current
+HAVING u.current - COALESCE(SUM(b.amount), 0) <> 0;
+
+ALTER TABLE ledger_backfill ADD COLUMN transaction_id BIGINT NOT NULL DEFAULT nextval('ledger_transaction_seq');
+
+INSERT INTO ledger_entries (transaction_id, account, login, order_id, type, amount)
+SELECT transaction_id, 'user:' || login, login, order_id, type, amount
+FROM ledger_backfill
+UNION ALL
+SELECT transaction_id, 'system:' || lower(type::TEXT), login, order_id, type, -amount
+FROM ledger_backfill;
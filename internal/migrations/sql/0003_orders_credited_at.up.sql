@@ -0,0 +1,4 @@
+ALTER TABLE orders ADD COLUMN credited_at TIMESTAMPTZ;
+
+-- Orders with an accrual have already been credited at least once before this migration.
+UPDATE orders SET credited_at = now() WHERE accrual <> 0;
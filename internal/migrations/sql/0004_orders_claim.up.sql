@@ -0,0 +1,2 @@
+-- Orders are claimed by a poller until locked_until, so replicas sharing the database don't poll the same order.
+ALTER TABLE orders ADD COLUMN locked_until TIMESTAMPTZ;
@@ -0,0 +1,8 @@
+DROP VIEW IF EXISTS orders_dead_letter;
+DROP INDEX IF EXISTS orders_pending_idx;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS poll_attempts,
+    DROP COLUMN IF EXISTS next_poll_at,
+    DROP COLUMN IF EXISTS last_poll_error,
+    DROP COLUMN IF EXISTS dead_lettered_at;
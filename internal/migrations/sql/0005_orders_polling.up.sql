@@ -0,0 +1,14 @@
+ALTER TABLE orders
+    ADD COLUMN poll_attempts INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN next_poll_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN last_poll_error TEXT,
+    ADD COLUMN dead_lettered_at TIMESTAMPTZ;
+
+CREATE INDEX orders_pending_idx ON orders (next_poll_at)
+    WHERE status IN ('NEW', 'PROCESSING') AND dead_lettered_at IS NULL;
+
+-- Orders the worker gave up on after too many failed polls, for operators to inspect.
+CREATE VIEW orders_dead_letter AS
+SELECT order_id, login, status, poll_attempts, last_poll_error, uploaded_at, dead_lettered_at
+FROM orders
+WHERE dead_lettered_at IS NOT NULL;
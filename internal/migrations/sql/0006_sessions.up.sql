@@ -0,0 +1,15 @@
+-- Refresh token sessions. A refresh rotates the session: the used one is marked rotated and a new one
+-- of the same family is created, so reuse of a rotated token is detected and revokes the whole family.
+CREATE TABLE sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    family_id VARCHAR(64) NOT NULL,
+    login VARCHAR(64) NOT NULL REFERENCES users(login),
+    refresh_token_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    rotated_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX sessions_family_idx ON sessions (family_id);
+CREATE INDEX sessions_login_idx ON sessions (login);
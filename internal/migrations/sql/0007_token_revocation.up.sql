@@ -0,0 +1,12 @@
+-- Access tokens carry the generation they were issued with, bumping it revokes all tokens of the user.
+ALTER TABLE users ADD COLUMN token_generation INTEGER NOT NULL DEFAULT 0;
+
+-- Denylist of single access tokens revoked before their expiration, cleaned up after it.
+CREATE TABLE revoked_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    login VARCHAR(64) NOT NULL REFERENCES users(login),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX revoked_tokens_expires_at_idx ON revoked_tokens (expires_at);
+CREATE INDEX sessions_expires_at_idx ON sessions (expires_at);
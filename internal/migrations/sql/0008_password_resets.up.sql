@@ -0,0 +1,10 @@
+-- Single-use password reset tokens, only the sha256 of a token is stored.
+CREATE TABLE password_resets (
+    token_hash VARCHAR(64) PRIMARY KEY,
+    login VARCHAR(64) NOT NULL REFERENCES users(login),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX password_resets_expires_at_idx ON password_resets (expires_at);
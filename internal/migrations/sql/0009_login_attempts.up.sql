@@ -0,0 +1,10 @@
+-- Failed login attempts by login ("login:<hex of sha256 of the login>") and by client IP ("ip:<ip>"),
+-- a key is locked out for a while after too many failures in a row.
+CREATE TABLE login_attempts (
+    key VARCHAR(128) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX login_attempts_updated_at_idx ON login_attempts (updated_at);
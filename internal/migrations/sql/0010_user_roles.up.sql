@@ -0,0 +1,3 @@
+-- Roles grant access to the admin API, a blocked user can neither log in nor use issued tokens.
+ALTER TABLE users ADD COLUMN roles TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE users ADD COLUMN blocked_at TIMESTAMPTZ;
@@ -0,0 +1,3 @@
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS created_by;
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS comment;
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS reason_code;
@@ -0,0 +1,4 @@
+-- Manual adjustments by support staff carry a reason code, a comment and the admin who made them.
+ALTER TABLE ledger_entries ADD COLUMN reason_code VARCHAR(32);
+ALTER TABLE ledger_entries ADD COLUMN comment TEXT;
+ALTER TABLE ledger_entries ADD COLUMN created_by VARCHAR(64);
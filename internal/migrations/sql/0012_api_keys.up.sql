@@ -0,0 +1,12 @@
+-- API keys of partner services, only the sha256 of a key is stored. Orders uploaded with a key keep its id.
+CREATE TABLE api_keys (
+    id VARCHAR(32) PRIMARY KEY,
+    name VARCHAR(128) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_by VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ
+);
+
+ALTER TABLE orders ADD COLUMN api_key_id VARCHAR(32) REFERENCES api_keys(id);
@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS orders_withdraws_login_processed_at_idx;
+DROP INDEX IF EXISTS orders_login_uploaded_at_idx;
+
+DROP VIEW orders_dead_letter;
+
+ALTER TABLE orders ALTER COLUMN uploaded_at TYPE VARCHAR(32)
+    USING to_char(uploaded_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"');
+ALTER TABLE orders_withdraws ALTER COLUMN processed_at TYPE VARCHAR(32)
+    USING to_char(processed_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24:MI:SS"Z"');
+
+CREATE VIEW orders_dead_letter AS
+SELECT order_id, login, status, poll_attempts, last_poll_error, uploaded_at, dead_lettered_at
+FROM orders
+WHERE dead_lettered_at IS NOT NULL;
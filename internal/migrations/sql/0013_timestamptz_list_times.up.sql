@@ -0,0 +1,14 @@
+-- uploaded_at and processed_at were RFC 3339 texts, the lists filter and sort by them as timestamps,
+-- and a cast of the text can't be indexed.
+DROP VIEW orders_dead_letter;
+
+ALTER TABLE orders ALTER COLUMN uploaded_at TYPE TIMESTAMPTZ USING uploaded_at::TIMESTAMPTZ;
+ALTER TABLE orders_withdraws ALTER COLUMN processed_at TYPE TIMESTAMPTZ USING processed_at::TIMESTAMPTZ;
+
+CREATE VIEW orders_dead_letter AS
+SELECT order_id, login, status, poll_attempts, last_poll_error, uploaded_at, dead_lettered_at
+FROM orders
+WHERE dead_lettered_at IS NOT NULL;
+
+CREATE INDEX orders_login_uploaded_at_idx ON orders (login, uploaded_at, order_id);
+CREATE INDEX orders_withdraws_login_processed_at_idx ON orders_withdraws (login, processed_at, order_id);
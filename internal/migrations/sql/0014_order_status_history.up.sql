@@ -0,0 +1,13 @@
+-- Status transitions of orders: NEW on upload, then every status the worker saves.
+CREATE TABLE order_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_id VARCHAR(64) NOT NULL REFERENCES orders(order_id) ON DELETE CASCADE,
+    status order_status NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX order_status_history_order_idx ON order_status_history (order_id, id);
+
+-- The transitions of existing orders weren't recorded, their current status is the only known one.
+INSERT INTO order_status_history (order_id, status, changed_at)
+SELECT order_id, status, uploaded_at::timestamptz FROM orders WHERE status IS NOT NULL;
@@ -0,0 +1,60 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileNotifier appends notifications to a file as JSON lines, so a local mail stub can pick them up.
+type fileNotifier struct {
+	path string
+	mu   sync.Mutex
+}
+
+type message struct {
+	Kind      string    `json:"kind"`
+	Login     string    `json:"login"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	SentAt    time.Time `json:"sent_at"`
+}
+
+func NewFile(path string) *fileNotifier {
+	return &fileNotifier{path: path}
+}
+
+func (n *fileNotifier) NotifyPasswordReset(ctx context.Context, login, token string, expiresAt time.Time) error {
+	return n.write(message{
+		Kind:      "password_reset",
+		Login:     login,
+		Token:     token,
+		ExpiresAt: expiresAt,
+		SentAt:    time.Now(),
+	})
+}
+
+func (n *fileNotifier) write(m message) error {
+	line, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	f, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("error to open notifications file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("error to write notification: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package notifier
+
+import (
+	"context"
+	"time"
+
+	"github.com/IgorAleksandroff/gophermart/pkg/logger"
+)
+
+// logNotifier writes notifications with the reset tokens to the service log. Anyone who reads the log
+// can reset the password, so it's for development only.
+type logNotifier struct {
+	l *logger.Logger
+}
+
+func NewLog(l *logger.Logger) *logNotifier {
+	return &logNotifier{l: l}
+}
+
+func (n *logNotifier) NotifyPasswordReset(ctx context.Context, login, token string, expiresAt time.Time) error {
+	n.l.Info("password reset for %s: token %s, expires at %s", login, token, expiresAt.Format(time.RFC3339))
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+	"github.com/IgorAleksandroff/gophermart/pkg/logger"
+)
+
+// testDatabaseURIEnv is the DSN of a disposable database for the postgres tests, they're skipped without it.
+const testDatabaseURIEnv = "TEST_DATABASE_URI"
+
+const concurrentSaves = 8
+
+type creditRepository interface {
+	SaveUser(ctx context.Context, user entity.User) error
+	CreateOrder(ctx context.Context, order entity.Order) (bool, error)
+	SaveOrder(ctx context.Context, order entity.Order) error
+	GetUser(ctx context.Context, login string) (entity.User, error)
+	GetLedger(ctx context.Context, login string, limit, offset int) ([]entity.LedgerEntry, error)
+}
+
+// creditedAtFunc returns the time the order was credited at, the zero time if it wasn't.
+type creditedAtFunc func(t *testing.T, orderID string) time.Time
+
+func TestMemoRepSaveOrderCreditsOnce(t *testing.T) {
+	repo := NewMemoRepository(context.Background(), logger.New("error"))
+
+	testSaveOrderCreditsOnce(t, repo, func(t *testing.T, orderID string) time.Time {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+
+		return repo.credited[orderID]
+	})
+}
+
+func TestPGRepSaveOrderCreditsOnce(t *testing.T) {
+	uri := os.Getenv(testDatabaseURIEnv)
+	if uri == "" {
+		t.Skipf("%s isn't set", testDatabaseURIEnv)
+	}
+
+	repo := NewPGRepository(context.Background(), logger.New("error"), uri)
+	t.Cleanup(repo.Close)
+
+	testSaveOrderCreditsOnce(t, repo, func(t *testing.T, orderID string) time.Time {
+		var creditedAt sql.NullTime
+		err := repo.db.QueryRowContext(context.Background(),
+			`SELECT credited_at FROM orders WHERE order_id = $1`, orderID).Scan(&creditedAt)
+		if err != nil {
+			t.Fatalf("get credited_at of %s: %v", orderID, err)
+		}
+
+		return creditedAt.Time
+	})
+}
+
+func testSaveOrderCreditsOnce(t *testing.T, repo creditRepository, creditedAt creditedAtFunc) {
+	accrual, err := entity.ParseAmount("500.5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("saved twice", func(t *testing.T) {
+		ctx := context.Background()
+		order := newProcessedOrder(t, repo, accrual)
+
+		if err := repo.SaveOrder(ctx, order); err != nil {
+			t.Fatalf("first save: %v", err)
+		}
+		first := creditedAt(t, order.OrderID)
+		if first.IsZero() {
+			t.Fatal("credited_at isn't set after the first save")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		if err := repo.SaveOrder(ctx, order); err != nil {
+			t.Fatalf("second save: %v", err)
+		}
+
+		assertCreditedOnce(t, repo, order, accrual)
+		if second := creditedAt(t, order.OrderID); !second.Equal(first) {
+			t.Errorf("credited_at changed from %v to %v", first, second)
+		}
+	})
+
+	t.Run("saved concurrently", func(t *testing.T) {
+		ctx := context.Background()
+		order := newProcessedOrder(t, repo, accrual)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, concurrentSaves)
+		for i := 0; i < concurrentSaves; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- repo.SaveOrder(ctx, order)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("concurrent save: %v", err)
+			}
+		}
+
+		assertCreditedOnce(t, repo, order, accrual)
+		first := creditedAt(t, order.OrderID)
+		if first.IsZero() {
+			t.Fatal("credited_at isn't set")
+		}
+
+		if err := repo.SaveOrder(ctx, order); err != nil {
+			t.Fatalf("save after the concurrent ones: %v", err)
+		}
+		if second := creditedAt(t, order.OrderID); !second.Equal(first) {
+			t.Errorf("credited_at changed from %v to %v", first, second)
+		}
+	})
+}
+
+// newProcessedOrder registers a new user with a new order and returns the order as the worker saves it
+// when the accrual system has processed it.
+func newProcessedOrder(t *testing.T, repo creditRepository, accrual entity.Amount) entity.Order {
+	t.Helper()
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+
+	user := entity.User{Login: fmt.Sprintf("credit-test-%d", suffix), Password: "hash"}
+	if err := repo.SaveUser(ctx, user); err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+
+	order := entity.Order{
+		OrderID:   fmt.Sprintf("%d", suffix),
+		UserLogin: user.Login,
+		Status:    entity.StatusNew,
+	}
+	if _, err := repo.CreateOrder(ctx, order); err != nil {
+		t.Fatalf("create order: %v", err)
+	}
+
+	order.Status = entity.StatusProcessed
+	order.Accrual = accrual
+
+	return order
+}
+
+func assertCreditedOnce(t *testing.T, repo creditRepository, order entity.Order, accrual entity.Amount) {
+	t.Helper()
+	ctx := context.Background()
+
+	user, err := repo.GetUser(ctx, order.UserLogin)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if user.Current != accrual {
+		t.Errorf("balance is %s, want %s", user.Current, accrual)
+	}
+
+	entries, err := repo.GetLedger(ctx, order.UserLogin, 100, 0)
+	if err != nil {
+		t.Fatalf("get ledger: %v", err)
+	}
+
+	transactions := make(map[int64]struct{})
+	for _, entry := range entries {
+		if entry.OrderID != order.OrderID || entry.Type != entity.LedgerAccrual {
+			continue
+		}
+		if entry.Amount != accrual {
+			t.Errorf("ledger entry amount is %s, want %s", entry.Amount, accrual)
+		}
+		transactions[entry.TransactionID] = struct{}{}
+	}
+	if len(transactions) != 1 {
+		t.Errorf("got %d accrual ledger transactions, want 1", len(transactions))
+	}
+}
@@ -3,19 +3,46 @@ package repository
 import (
 	"context"
 	"errors"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/IgorAleksandroff/gophermart/internal/entity"
+	"github.com/IgorAleksandroff/gophermart/internal/usecase"
 	"github.com/IgorAleksandroff/gophermart/pkg/logger"
 )
 
+// orderPoll is the polling state of an order, the in-memory counterpart of the orders polling columns.
+type orderPoll struct {
+	lockedUntil    time.Time
+	nextPollAt     time.Time
+	lastError      string
+	deadLetteredAt time.Time
+}
+
+// loginAttempt is the failed login attempts of a key, the in-memory counterpart of login_attempts.
+type loginAttempt struct {
+	failures    int
+	lockedUntil time.Time
+	updatedAt   time.Time
+}
+
 type memoRep struct {
-	orders   map[string]entity.Order
-	users    map[string]entity.User
-	withdraw map[string]entity.OrderWithdraw
-	mu       *sync.Mutex
-	l        *logger.Logger
+	orders        map[string]entity.Order
+	users         map[string]entity.User
+	withdraw      map[string]entity.OrderWithdraw
+	credited      map[string]time.Time
+	polls         map[string]orderPoll
+	history       map[string][]entity.OrderStatusChange
+	sessions      map[string]entity.Session
+	revoked       map[string]time.Time
+	resets        map[string]entity.PasswordReset
+	loginAttempts map[string]loginAttempt
+	apiKeys       map[string]entity.APIKey
+	ledger        []entity.LedgerEntry
+	transactionID int64
+	mu            *sync.Mutex
+	l             *logger.Logger
 }
 
 func NewMemoRepository(ctx context.Context, log *logger.Logger) *memoRep {
@@ -23,7 +50,21 @@ func NewMemoRepository(ctx context.Context, log *logger.Logger) *memoRep {
 	u := make(map[string]entity.User)
 	w := make(map[string]entity.OrderWithdraw)
 
-	return &memoRep{orders: o, users: u, withdraw: w, mu: &sync.Mutex{}, l: log}
+	return &memoRep{
+		orders:        o,
+		users:         u,
+		withdraw:      w,
+		credited:      make(map[string]time.Time),
+		polls:         make(map[string]orderPoll),
+		history:       make(map[string][]entity.OrderStatusChange),
+		sessions:      make(map[string]entity.Session),
+		revoked:       make(map[string]time.Time),
+		resets:        make(map[string]entity.PasswordReset),
+		loginAttempts: make(map[string]loginAttempt),
+		apiKeys:       make(map[string]entity.APIKey),
+		mu:            &sync.Mutex{},
+		l:             log,
+	}
 }
 
 func (m *memoRep) SaveUser(ctx context.Context, user entity.User) error {
@@ -52,67 +93,148 @@ func (m *memoRep) GetUser(ctx context.Context, login string) (entity.User, error
 	return userSaved, nil
 }
 
+func (m *memoRep) UpdatePassword(ctx context.Context, login, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userSaved, ok := m.users[login]
+	if !ok {
+		return ErrUserLogin
+	}
+
+	userSaved.Password = passwordHash
+	m.users[login] = userSaved
+
+	return nil
+}
+
 func (m *memoRep) GetOrder(ctx context.Context, orderID string) (*entity.Order, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	existedOrder, ok := m.orders[orderID]
 	if !ok {
-		return nil, errors.New("unknown order")
+		return nil, usecase.ErrUnknownOrder
 	}
 
 	return &existedOrder, nil
 }
 
-func (m *memoRep) SaveOrder(ctx context.Context, order entity.Order) error {
+func (m *memoRep) CreateOrder(ctx context.Context, order entity.Order) (bool, error) {
 	order.UploadedAt = time.Now().Format(time.RFC3339)
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if _, ok := m.orders[order.OrderID]; ok {
+		return false, nil
+	}
+
 	m.orders[order.OrderID] = order
+	m.addOrderStatus(order.OrderID, order.Status)
 
-	return nil
+	return true, nil
 }
 
-func (m *memoRep) GetOrders(ctx context.Context, login string) ([]entity.Orders, error) {
+func (m *memoRep) CreateOrders(ctx context.Context, orders []entity.Order) (map[string]string, error) {
+	uploadedAt := time.Now().Format(time.RFC3339)
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	result := make([]entity.Orders, 0, len(m.orders))
-	for _, order := range m.orders {
-		if order.UserLogin == login {
-			result = append(result, entity.Orders{
-				OrderID:    order.OrderID,
-				Status:     order.Status,
-				Accrual:    order.Accrual,
-				UploadedAt: order.UploadedAt,
-			})
+	owners := make(map[string]string)
+	for _, order := range orders {
+		if existed, ok := m.orders[order.OrderID]; ok {
+			owners[order.OrderID] = existed.UserLogin
+			continue
 		}
+
+		order.UploadedAt = uploadedAt
+		m.orders[order.OrderID] = order
+		m.addOrderStatus(order.OrderID, order.Status)
 	}
 
-	return result, nil
+	return owners, nil
 }
 
-func (m *memoRep) UpdateUser(ctx context.Context, user entity.User) error {
+func (m *memoRep) SaveOrder(ctx context.Context, order entity.Order) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	_, ok := m.users[user.Login]
-	if !ok {
-		return errors.New("unknown user")
+	if existedOrder, ok := m.orders[order.OrderID]; ok {
+		order.UploadedAt = existedOrder.UploadedAt
+	} else {
+		order.UploadedAt = time.Now().Format(time.RFC3339)
 	}
 
-	m.users[user.Login] = user
+	if order.Status == completedStatus && order.Accrual != 0 {
+		if err := m.creditOrder(order); err != nil {
+			return err
+		}
+	}
+
+	order.PollAttempts = 0
+	m.orders[order.OrderID] = order
+	m.polls[order.OrderID] = orderPoll{nextPollAt: time.Now().Add(repollDelay)}
+	m.addOrderStatus(order.OrderID, order.Status)
 
 	return nil
 }
 
-func (m *memoRep) SupplementBalance(ctx context.Context, order entity.Order) error {
+func (m *memoRep) GetOrderHistory(ctx context.Context, orderID string) ([]entity.OrderStatusChange, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if order.Accrual == 0 {
+	return append([]entity.OrderStatusChange(nil), m.history[orderID]...), nil
+}
+
+// addOrderStatus records the status unless it's the last recorded one, m.mu must be held.
+func (m *memoRep) addOrderStatus(orderID, status string) {
+	history := m.history[orderID]
+	if len(history) > 0 && history[len(history)-1].Status == status {
+		return
+	}
+
+	m.history[orderID] = append(history, entity.OrderStatusChange{
+		Status:    status,
+		ChangedAt: time.Now().Format(time.RFC3339Nano),
+	})
+}
+
+func (m *memoRep) GetOrders(ctx context.Context, login string, filter entity.ListFilter) ([]entity.Orders, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]entity.Orders, 0, filter.Limit)
+	for _, order := range m.orders {
+		if order.UserLogin != login {
+			continue
+		}
+		if !listed(filter, order.UploadedAt, order.OrderID, order.Status) {
+			continue
+		}
+
+		result = append(result, entity.Orders{
+			OrderID:    order.OrderID,
+			Status:     order.Status,
+			Accrual:    order.Accrual,
+			UploadedAt: order.UploadedAt,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return older(result[i].UploadedAt, result[i].OrderID, result[j].UploadedAt, result[j].OrderID)
+	})
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[:filter.Limit]
+	}
+
+	return result, nil
+}
+
+// creditOrder supplements the user balance once per order, m.mu must be held.
+func (m *memoRep) creditOrder(order entity.Order) error {
+	if _, ok := m.credited[order.OrderID]; ok {
 		return nil
 	}
 
@@ -121,61 +243,645 @@ func (m *memoRep) SupplementBalance(ctx context.Context, order entity.Order) err
 		return errors.New("unknown user")
 	}
 
-	userSaved.Current = userSaved.Current + order.Accrual
+	current, err := userSaved.Current.Add(order.Accrual)
+	if err != nil {
+		return err
+	}
+
+	userSaved.Current = current
 	m.users[order.UserLogin] = userSaved
+	m.credited[order.OrderID] = time.Now()
+
+	m.saveLedgerTransaction(entity.LedgerEntry{
+		UserLogin: order.UserLogin,
+		OrderID:   order.OrderID,
+		Type:      entity.LedgerAccrual,
+		Amount:    order.Accrual,
+	})
 
 	return nil
 }
 
-func (m *memoRep) SaveWithdrawn(ctx context.Context, withdrawn entity.OrderWithdraw) error {
+func (m *memoRep) Withdraw(ctx context.Context, withdrawn entity.OrderWithdraw) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	_, ok := m.withdraw[withdrawn.OrderID]
-	if ok {
-		return errors.New("withdrawn already exist")
+	userSaved, ok := m.users[withdrawn.UserLogin]
+	if !ok {
+		return ErrUserLogin
+	}
+
+	if _, ok = m.withdraw[withdrawn.OrderID]; ok {
+		return usecase.ErrWithdrawalExists
+	}
+
+	if withdrawn.Value > userSaved.Current {
+		return usecase.ErrLowBalance
+	}
+
+	current, err := userSaved.Current.Sub(withdrawn.Value)
+	if err != nil {
+		return err
+	}
+	total, err := userSaved.Withdrawn.Add(withdrawn.Value)
+	if err != nil {
+		return err
 	}
 
+	withdrawn.ProcessedAt = time.Now().Format(time.RFC3339)
 	m.withdraw[withdrawn.OrderID] = withdrawn
 
+	userSaved.Current = current
+	userSaved.Withdrawn = total
+	m.users[withdrawn.UserLogin] = userSaved
+
+	m.saveLedgerTransaction(entity.LedgerEntry{
+		UserLogin: withdrawn.UserLogin,
+		OrderID:   withdrawn.OrderID,
+		Type:      entity.LedgerWithdrawal,
+		Amount:    withdrawn.Value.Neg(),
+	})
+
+	return nil
+}
+
+func (m *memoRep) Adjust(ctx context.Context, adjustment entity.Adjustment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userSaved, ok := m.users[adjustment.UserLogin]
+	if !ok {
+		return ErrUserLogin
+	}
+
+	current, err := userSaved.Current.Add(adjustment.Amount)
+	if err != nil {
+		return err
+	}
+	if current < 0 {
+		return usecase.ErrLowBalance
+	}
+
+	userSaved.Current = current
+	m.users[adjustment.UserLogin] = userSaved
+
+	m.saveLedgerTransaction(entity.LedgerEntry{
+		UserLogin:  adjustment.UserLogin,
+		Type:       entity.LedgerAdjustment,
+		Amount:     adjustment.Amount,
+		ReasonCode: adjustment.ReasonCode,
+		Comment:    adjustment.Comment,
+		CreatedBy:  adjustment.CreatedBy,
+	})
+
 	return nil
 }
 
-func (m *memoRep) GetWithdrawals(ctx context.Context, login string) ([]entity.OrderWithdraw, error) {
+func (m *memoRep) GetWithdrawals(
+	ctx context.Context,
+	login string,
+	filter entity.ListFilter,
+) ([]entity.OrderWithdraw, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	result := make([]entity.OrderWithdraw, 0, len(m.orders))
+	result := make([]entity.OrderWithdraw, 0, filter.Limit)
 	for _, order := range m.withdraw {
-		if order.UserLogin == login {
+		if order.UserLogin == login && listed(filter, order.ProcessedAt, order.OrderID, "") {
 			result = append(result, order)
 		}
 	}
 
+	sort.Slice(result, func(i, j int) bool {
+		return older(result[i].ProcessedAt, result[i].OrderID, result[j].ProcessedAt, result[j].OrderID)
+	})
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[:filter.Limit]
+	}
+
+	return result, nil
+}
+
+func (m *memoRep) GetLedger(ctx context.Context, login string, limit, offset int) ([]entity.LedgerEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account := entity.UserAccount(login)
+	result := make([]entity.LedgerEntry, 0, limit)
+	for i := len(m.ledger) - 1; i >= 0 && len(result) < limit; i-- {
+		if m.ledger[i].Account != account {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		result = append(result, m.ledger[i])
+	}
+
+	return result, nil
+}
+
+func (m *memoRep) ReconcileBalances(ctx context.Context) ([]entity.BalanceDrift, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sums := make(map[string]entity.BalanceDrift, len(m.users))
+	for _, entry := range m.ledger {
+		if entry.Account != entity.UserAccount(entry.UserLogin) {
+			continue
+		}
+
+		var err error
+		sum := sums[entry.UserLogin]
+		if sum.LedgerCurrent, err = sum.LedgerCurrent.Add(entry.Amount); err != nil {
+			return nil, err
+		}
+		if entry.Type == entity.LedgerWithdrawal {
+			if sum.LedgerWithdrawn, err = sum.LedgerWithdrawn.Sub(entry.Amount); err != nil {
+				return nil, err
+			}
+		}
+		sums[entry.UserLogin] = sum
+	}
+
+	var result []entity.BalanceDrift
+	for login, user := range m.users {
+		drift := sums[login]
+		if drift.LedgerCurrent == user.Current && drift.LedgerWithdrawn == user.Withdrawn {
+			continue
+		}
+
+		drift.Login, drift.Current, drift.Withdrawn = login, user.Current, user.Withdrawn
+		result = append(result, drift)
+	}
+
 	return result, nil
 }
 
-func (m *memoRep) GetOrderForUpdate(ctx context.Context) (*entity.Order, error) {
+// saveLedgerTransaction appends the user side of the entry and the balancing system side, m.mu must be held.
+func (m *memoRep) saveLedgerTransaction(entry entity.LedgerEntry) {
+	m.transactionID++
+	entry.TransactionID = m.transactionID
+	entry.CreatedAt = time.Now().Format(time.RFC3339)
+
+	userEntry, systemEntry := entry, entry
+	userEntry.Account = entity.UserAccount(entry.UserLogin)
+	systemEntry.Account = entity.SystemAccount(entry.Type)
+	systemEntry.Amount = entry.Amount.Neg()
+
+	for _, e := range []entity.LedgerEntry{userEntry, systemEntry} {
+		e.ID = int64(len(m.ledger) + 1)
+		m.ledger = append(m.ledger, e)
+	}
+}
+
+func (m *memoRep) RetryOrder(ctx context.Context, retry entity.OrderRetry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[retry.OrderID]
+	if !ok {
+		return errors.New("unknown order")
+	}
+
+	order.PollAttempts = retry.Attempts
+	m.orders[retry.OrderID] = order
+
+	poll := orderPoll{nextPollAt: retry.NextPollAt, lastError: retry.LastError}
+	if retry.DeadLetter {
+		poll.deadLetteredAt = time.Now()
+	}
+	m.polls[retry.OrderID] = poll
+
+	return nil
+}
+
+func (m *memoRep) GetOrdersForUpdate(ctx context.Context, limit int) ([]entity.Order, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	var oldestOrder *entity.Order
+	now := time.Now()
+	result := make([]entity.Order, 0, limit)
 	for _, o := range m.orders {
-		if o.Status != completedStatus {
+		if o.Status != entity.StatusNew && o.Status != entity.StatusProcessing {
 			continue
 		}
 
-		if oldestOrder == nil {
-			oldestOrder = &o
+		poll := m.polls[o.OrderID]
+		if !poll.deadLetteredAt.IsZero() || now.Before(poll.nextPollAt) || now.Before(poll.lockedUntil) {
 			continue
 		}
 
-		if oldestOrder.UploadedAt < o.UploadedAt {
-			oldestOrder = &o
+		result = append(result, o)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return m.polls[result[i].OrderID].nextPollAt.Before(m.polls[result[j].OrderID].nextPollAt)
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	for _, o := range result {
+		poll := m.polls[o.OrderID]
+		poll.lockedUntil = now.Add(claimLease)
+		m.polls[o.OrderID] = poll
+	}
+
+	return result, nil
+}
+
+func (m *memoRep) SaveSession(ctx context.Context, session entity.Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session.CreatedAt = time.Now()
+	m.sessions[session.RefreshTokenHash] = session
+
+	return nil
+}
+
+func (m *memoRep) RotateSession(ctx context.Context, refreshTokenHash string, next entity.Session) (entity.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[refreshTokenHash]
+	if !ok {
+		return entity.Session{}, usecase.ErrInvalidRefreshToken
+	}
+
+	now := time.Now()
+	if session.RotatedAt != nil || session.RevokedAt != nil {
+		m.revokeSessionFamily(session.FamilyID, now)
+		return entity.Session{}, usecase.ErrRefreshTokenReused
+	}
+
+	if now.After(session.ExpiresAt) {
+		return entity.Session{}, usecase.ErrInvalidRefreshToken
+	}
+
+	session.RotatedAt = &now
+	m.sessions[refreshTokenHash] = session
+
+	next.FamilyID, next.UserLogin, next.CreatedAt = session.FamilyID, session.UserLogin, now
+	m.sessions[next.RefreshTokenHash] = next
+
+	return next, nil
+}
+
+func (m *memoRep) RevokeSessionFamily(ctx context.Context, familyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.revokeSessionFamily(familyID, time.Now())
+
+	return nil
+}
+
+func (m *memoRep) RevokeToken(ctx context.Context, identity entity.Identity) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.revoked[identity.TokenID] = identity.ExpiresAt
+
+	return nil
+}
+
+func (m *memoRep) RevokeUserTokens(ctx context.Context, login string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.revokeUserTokens(login)
+}
+
+func (m *memoRep) ChangePassword(ctx context.Context, login, passwordHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.revokeUserTokens(login); err != nil {
+		return err
+	}
+
+	userSaved := m.users[login]
+	userSaved.Password = passwordHash
+	m.users[login] = userSaved
+
+	return nil
+}
+
+func (m *memoRep) SavePasswordReset(ctx context.Context, reset entity.PasswordReset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[reset.UserLogin]; !ok {
+		return ErrUserLogin
+	}
+
+	reset.CreatedAt = time.Now()
+	m.resets[reset.TokenHash] = reset
+
+	return nil
+}
+
+func (m *memoRep) GetPasswordReset(ctx context.Context, tokenHash string) (entity.PasswordReset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reset, ok := m.resets[tokenHash]
+	if !ok || reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		return entity.PasswordReset{}, usecase.ErrInvalidResetToken
+	}
+
+	return reset, nil
+}
+
+func (m *memoRep) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reset, ok := m.resets[tokenHash]
+	now := time.Now()
+	if !ok || reset.UsedAt != nil || now.After(reset.ExpiresAt) {
+		return "", usecase.ErrInvalidResetToken
+	}
+
+	if err := m.revokeUserTokens(reset.UserLogin); err != nil {
+		return "", err
+	}
+
+	reset.UsedAt = &now
+	m.resets[tokenHash] = reset
+
+	userSaved := m.users[reset.UserLogin]
+	userSaved.Password = passwordHash
+	m.users[reset.UserLogin] = userSaved
+
+	return reset.UserLogin, nil
+}
+
+func (m *memoRep) GetTokenState(ctx context.Context, login, tokenID string) (entity.TokenState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userSaved, ok := m.users[login]
+	if !ok {
+		return entity.TokenState{}, ErrUserLogin
+	}
+
+	_, revoked := m.revoked[tokenID]
+
+	return entity.TokenState{
+		Generation: userSaved.TokenGeneration,
+		Revoked:    revoked,
+		Blocked:    userSaved.BlockedAt != nil,
+	}, nil
+}
+
+func (m *memoRep) SetUserBlocked(ctx context.Context, login string, blocked bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userSaved, ok := m.users[login]
+	if !ok {
+		return ErrUserLogin
+	}
+
+	switch {
+	case blocked && userSaved.BlockedAt == nil:
+		now := time.Now()
+		userSaved.BlockedAt = &now
+	case !blocked:
+		userSaved.BlockedAt = nil
+	}
+	m.users[login] = userSaved
+
+	if blocked {
+		return m.revokeUserTokens(login)
+	}
+
+	return nil
+}
+
+func (m *memoRep) SetUserRole(ctx context.Context, login, role string, granted bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userSaved, ok := m.users[login]
+	if !ok {
+		return ErrUserLogin
+	}
+
+	// a new slice, the previous one may be shared with a user returned by GetUser
+	roles := make([]string, 0, len(userSaved.Roles)+1)
+	for _, r := range userSaved.Roles {
+		if r != role {
+			roles = append(roles, r)
+		}
+	}
+	if granted {
+		roles = append(roles, role)
+	}
+	userSaved.Roles = roles
+	m.users[login] = userSaved
+
+	return m.revokeUserTokens(login)
+}
+
+func (m *memoRep) DeleteExpiredTokens(ctx context.Context) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var deleted int64
+	for jti, expiresAt := range m.revoked {
+		if now.After(expiresAt) {
+			delete(m.revoked, jti)
+			deleted++
+		}
+	}
+	for hash, s := range m.sessions {
+		if now.After(s.ExpiresAt) {
+			delete(m.sessions, hash)
+			deleted++
+		}
+	}
+	for hash, reset := range m.resets {
+		if now.After(reset.ExpiresAt) {
+			delete(m.resets, hash)
+			deleted++
+		}
+	}
+	for key, attempt := range m.loginAttempts {
+		if now.Sub(attempt.updatedAt) > 24*time.Hour && now.After(attempt.lockedUntil) {
+			delete(m.loginAttempts, key)
+			deleted++
 		}
 	}
 
-	return oldestOrder, nil
+	return deleted, nil
+}
+
+func (m *memoRep) AddLoginAttempt(ctx context.Context, key string, limits usecase.LoginLimits) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	attempt := m.loginAttempts[key]
+	if now.Before(attempt.lockedUntil) {
+		return attempt.lockedUntil, nil
+	}
+
+	if now.Sub(attempt.updatedAt) > limits.Window {
+		attempt.failures = 0
+	}
+	attempt.failures++
+	attempt.updatedAt = now
+	attempt.lockedUntil = time.Time{}
+	if lockout := limits.LockoutFor(attempt.failures); lockout > 0 {
+		attempt.lockedUntil = now.Add(lockout)
+	}
+	m.loginAttempts[key] = attempt
+
+	return time.Time{}, nil
+}
+
+func (m *memoRep) ReleaseLoginAttempt(ctx context.Context, key string, limits usecase.LoginLimits) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempt, ok := m.loginAttempts[key]
+	if !ok {
+		return nil
+	}
+	if attempt.failures > 0 {
+		attempt.failures--
+	}
+	if attempt.failures < limits.MaxAttempts {
+		attempt.lockedUntil = time.Time{}
+	}
+	m.loginAttempts[key] = attempt
+
+	return nil
+}
+
+func (m *memoRep) ResetLoginFailures(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.loginAttempts, key)
+
+	return nil
+}
+
+func (m *memoRep) SaveAPIKey(ctx context.Context, key entity.APIKey) (entity.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.apiKeys[key.ID]; ok {
+		return entity.APIKey{}, errors.New("api key already exist")
+	}
+
+	key.CreatedAt = time.Now()
+	m.apiKeys[key.ID] = key
+
+	return key, nil
+}
+
+func (m *memoRep) GetAPIKeys(ctx context.Context) ([]entity.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]entity.APIKey, 0, len(m.apiKeys))
+	for _, key := range m.apiKeys {
+		result = append(result, key)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+
+	return result, nil
+}
+
+func (m *memoRep) GetAPIKeyByHash(ctx context.Context, keyHash string) (entity.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range m.apiKeys {
+		if key.KeyHash == keyHash && key.RevokedAt == nil {
+			return key, nil
+		}
+	}
+
+	return entity.APIKey{}, usecase.ErrInvalidAPIKey
+}
+
+func (m *memoRep) RevokeAPIKey(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.apiKeys[id]
+	if !ok {
+		return usecase.ErrUnknownAPIKey
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+		m.apiKeys[id] = key
+	}
+
+	return nil
+}
+
+// revokeUserTokens bumps the user token generation and revokes all user sessions, m.mu must be held.
+func (m *memoRep) revokeUserTokens(login string) error {
+	userSaved, ok := m.users[login]
+	if !ok {
+		return ErrUserLogin
+	}
+
+	userSaved.TokenGeneration++
+	m.users[login] = userSaved
+
+	now := time.Now()
+	for hash, s := range m.sessions {
+		if s.UserLogin == login && s.RevokedAt == nil {
+			s.RevokedAt = &now
+			m.sessions[hash] = s
+		}
+	}
+
+	return nil
+}
+
+// revokeSessionFamily marks all not revoked sessions of the family revoked, m.mu must be held.
+func (m *memoRep) revokeSessionFamily(familyID string, now time.Time) {
+	for hash, s := range m.sessions {
+		if s.FamilyID == familyID && s.RevokedAt == nil {
+			s.RevokedAt = &now
+			m.sessions[hash] = s
+		}
+	}
 }
 
 func (m *memoRep) Close() {}
+
+// listed reports whether the item passes the filter and goes after its cursor, times are RFC 3339 texts.
+func listed(filter entity.ListFilter, at, orderID, status string) bool {
+	t, err := time.Parse(time.RFC3339, at)
+	if err != nil || !filter.Match(t, status) {
+		return false
+	}
+
+	return filter.Cursor == nil || filter.Cursor.After(t, orderID)
+}
+
+// older is the list order: the item a goes before b if it's older or has the lesser number at the same time.
+func older(aAt, aID, bAt, bID string) bool {
+	a, _ := time.Parse(time.RFC3339, aAt)
+	b, _ := time.Parse(time.RFC3339, bAt)
+	if !a.Equal(b) {
+		return a.Before(b)
+	}
+
+	return aID < bID
+}
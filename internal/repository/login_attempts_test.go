@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IgorAleksandroff/gophermart/internal/usecase"
+	"github.com/IgorAleksandroff/gophermart/pkg/logger"
+)
+
+const (
+	testMaxLoginAttempts = 3
+	// loginAttemptsKeySize is the size of the login_attempts.key column.
+	loginAttemptsKeySize = 128
+)
+
+func TestMemoRepLoginGuardLongLogin(t *testing.T) {
+	repo := NewMemoRepository(context.Background(), logger.New("error"))
+
+	testLoginGuardLongLogin(t, repo)
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	for key := range repo.loginAttempts {
+		if len(key) > loginAttemptsKeySize {
+			t.Errorf("key of %d bytes doesn't fit the login_attempts column", len(key))
+		}
+	}
+}
+
+func TestPGRepLoginGuardLongLogin(t *testing.T) {
+	uri := os.Getenv(testDatabaseURIEnv)
+	if uri == "" {
+		t.Skipf("%s isn't set", testDatabaseURIEnv)
+	}
+
+	repo := NewPGRepository(context.Background(), logger.New("error"), uri)
+	t.Cleanup(repo.Close)
+
+	testLoginGuardLongLogin(t, repo)
+}
+
+// testLoginGuardLongLogin guesses the password of a login far longer than the login_attempts key column:
+// the attempts must be counted and lock the login out like any other.
+func testLoginGuardLongLogin(t *testing.T, repo usecase.LoginAttemptsRepository) {
+	ctx := context.Background()
+	guard := usecase.NewLoginGuard(repo, testMaxLoginAttempts, 0, time.Minute, time.Hour)
+
+	login := fmt.Sprintf("%d-%s", time.Now().UnixNano(), strings.Repeat("x", 1000))
+	ip := fmt.Sprintf("192.0.2.%d", time.Now().UnixNano()%250+1)
+
+	for i := 0; i < testMaxLoginAttempts; i++ {
+		if err := guard.Attempt(ctx, login, ip); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+	}
+
+	var lockedErr *usecase.LoginLockedError
+	if err := guard.Attempt(ctx, login, ip); !errors.As(err, &lockedErr) {
+		t.Fatalf("attempt over the limit: error = %v, want LoginLockedError", err)
+	}
+
+	// another long login with the same prefix is a different key
+	other := login[:len(login)-1] + "y"
+	if err := guard.Attempt(ctx, other, ip); err != nil {
+		t.Errorf("attempt of another long login: %v", err)
+	}
+}
@@ -2,67 +2,185 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	l "log"
 	"time"
 
 	"github.com/IgorAleksandroff/gophermart/internal/entity"
+	"github.com/IgorAleksandroff/gophermart/internal/migrations"
+	"github.com/IgorAleksandroff/gophermart/internal/usecase"
 	"github.com/IgorAleksandroff/gophermart/pkg/logger"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 const completedStatus = "PROCESSED"
 
 const (
-	queryCreateTables = `	
-		CREATE TYPE order_status AS ENUM (
-			'NEW',
-			'PROCESSING',
-			'INVALID',
-			'PROCESSED'
-		);
-		CREATE TABLE IF NOT EXISTS users (
-			login VARCHAR(64) PRIMARY KEY,
-			password VARCHAR(128) NOT NULL,
-			current DECIMAL(16, 4) NOT NULL DEFAULT 0,
-			withdrawn DECIMAL(16, 4) NOT NULL DEFAULT 0
-		);
-		CREATE TABLE IF NOT EXISTS orders (
-			order_id VARCHAR(64) PRIMARY KEY,
-			login VARCHAR(64) REFERENCES users(login),
-			status order_status,
-			accrual DECIMAL(16, 4) NOT NULL DEFAULT 0,
-			uploaded_at VARCHAR(32) NOT NULL
-		);
-		CREATE TABLE IF NOT EXISTS orders_withdraws (
-			order_id VARCHAR(64) PRIMARY KEY,
-			login VARCHAR(64) REFERENCES users(login),
-			value DECIMAL(16, 4) NOT NULL DEFAULT 0,
-			processed_at VARCHAR(32) NOT NULL
-		);
-	`
+	// claimLease is how long a claimed order stays hidden from other pollers if it isn't saved.
+	claimLease = time.Minute
+	// repollDelay is how soon an order still processed by the accrual system is polled again.
+	repollDelay = 5 * time.Second
+)
+
+const (
 	querySaveUser = `INSERT INTO users (login, password) VALUES ($1, $2)
 		ON CONFLICT (login) DO NOTHING`
-	queryGetUser    = `SELECT login, password, current, withdrawn FROM users WHERE login = $1`
-	queryUpdateUser = `UPDATE users 
-		SET current = $2,
-				withdrawn = $3
+	queryGetUser = `SELECT login, password, current, withdrawn, token_generation, roles, blocked_at
+		FROM users WHERE login = $1`
+	queryUpdatePassword   = `UPDATE users SET password = $2 WHERE login = $1`
+	queryGetUserForUpdate = `SELECT current FROM users WHERE login = $1 FOR UPDATE`
+	queryWithdrawUser     = `UPDATE users 
+		SET current = current - $2,
+				withdrawn = withdrawn + $2
 		WHERE login = $1`
 	querySupplementUser = `UPDATE users 
 		SET current = current + $2
 		WHERE login = $1`
 
+	queryCreateOrder = `WITH created AS (
+			INSERT INTO orders (order_id, login, status, uploaded_at, api_key_id) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (order_id) DO NOTHING
+			RETURNING order_id, status
+		)
+		INSERT INTO order_status_history (order_id, status) SELECT order_id, status FROM created`
 	querySaveOrder = `INSERT INTO orders (order_id, login, status, accrual, uploaded_at) VALUES ($1, $2, $3, $4, $5)
 		ON CONFLICT (order_id) DO UPDATE
-		    SET (status, accrual, uploaded_at) = (EXCLUDED.status, EXCLUDED.accrual, EXCLUDED.uploaded_at)`
-	queryGetOrder          = `SELECT order_id, login, status, accrual, uploaded_at FROM orders WHERE order_id = $1`
-	queryGetOrders         = `SELECT order_id, status, accrual, uploaded_at FROM orders WHERE login = $1`
-	queryGetOrderForUpdate = `SELECT order_id, login, status, accrual, uploaded_at FROM orders WHERE status != $1 ORDER BY uploaded_at`
+		    SET (status, accrual, locked_until, poll_attempts, last_poll_error, next_poll_at) =
+		        (EXCLUDED.status, EXCLUDED.accrual, NULL, 0, NULL, now() + make_interval(secs => $6))`
+	// queryAddOrderStatus records the status unless it's the last recorded one, as a re-polled order keeps its status.
+	queryAddOrderStatus = `INSERT INTO order_status_history (order_id, status)
+		SELECT $1, $2
+		WHERE $2::order_status IS DISTINCT FROM (
+			SELECT status FROM order_status_history WHERE order_id = $1 ORDER BY id DESC LIMIT 1
+		)`
+	queryGetOrderHistory = `SELECT status, changed_at FROM order_status_history WHERE order_id = $1 ORDER BY id`
+	queryRetryOrder      = `UPDATE orders
+		SET (locked_until, poll_attempts, next_poll_at, last_poll_error, dead_lettered_at) =
+		    (NULL, $2, $3, $4, CASE WHEN $5 THEN now() END)
+		WHERE order_id = $1`
+	queryMarkOrderCredited    = `UPDATE orders SET credited_at = now() WHERE order_id = $1 AND credited_at IS NULL`
+	queryGetOrder             = `SELECT order_id, login, status, accrual, uploaded_at FROM orders WHERE order_id = $1`
+	queryClaimOrdersForUpdate = `WITH claimed AS (
+			SELECT order_id FROM orders
+			WHERE status IN ('NEW', 'PROCESSING')
+				AND dead_lettered_at IS NULL
+				AND next_poll_at <= now()
+				AND (locked_until IS NULL OR locked_until < now())
+			ORDER BY next_poll_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE orders o SET locked_until = now() + make_interval(secs => $2)
+		FROM claimed
+		WHERE o.order_id = claimed.order_id
+		RETURNING o.order_id, o.login, o.status, o.accrual, o.uploaded_at, o.poll_attempts`
 
 	querySaveWithdrawn = `INSERT INTO orders_withdraws (order_id, login, value, processed_at) VALUES ($1, $2, $3, $4)
 		ON CONFLICT (order_id) DO NOTHING`
-	queryGetWithdrawals = `SELECT order_id, login, value, processed_at FROM orders_withdraws WHERE login = $1`
+	// the lists are sorted oldest first, ties by the order number, and go on after the cursor of the last row.
+	// A NULL limit is no limit.
+	queryGetOrders = `SELECT order_id, status, accrual, uploaded_at FROM orders
+		WHERE login = $1
+		  AND (cardinality($2::text[]) = 0 OR status::text = ANY($2))
+		  AND ($3::timestamptz IS NULL OR uploaded_at >= $3)
+		  AND ($4::timestamptz IS NULL OR uploaded_at < $4)
+		  AND ($5::timestamptz IS NULL OR (uploaded_at, order_id) > ($5, $6::text))
+		ORDER BY uploaded_at, order_id
+		LIMIT $7`
+	queryGetWithdrawals = `SELECT order_id, login, value, processed_at FROM orders_withdraws
+		WHERE login = $1
+		  AND ($2::timestamptz IS NULL OR processed_at >= $2)
+		  AND ($3::timestamptz IS NULL OR processed_at < $3)
+		  AND ($4::timestamptz IS NULL OR (processed_at, order_id) > ($4, $5::text))
+		ORDER BY processed_at, order_id
+		LIMIT $6`
+
+	querySaveSession = `INSERT INTO sessions (id, family_id, login, refresh_token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`
+	queryGetSessionForUpdate = `SELECT id, family_id, login, refresh_token_hash, created_at, expires_at, rotated_at, revoked_at
+		FROM sessions WHERE refresh_token_hash = $1 FOR UPDATE`
+	queryRotateSession         = `UPDATE sessions SET rotated_at = now() WHERE id = $1`
+	queryRevokeSessionFamily   = `UPDATE sessions SET revoked_at = now() WHERE family_id = $1 AND revoked_at IS NULL`
+	queryRevokeUserSessions    = `UPDATE sessions SET revoked_at = now() WHERE login = $1 AND revoked_at IS NULL`
+	queryDeleteExpiredSessions = `DELETE FROM sessions WHERE expires_at < now()`
+
+	queryRevokeToken = `INSERT INTO revoked_tokens (jti, login, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING`
+	queryIncrementTokenGeneration = `UPDATE users SET token_generation = token_generation + 1 WHERE login = $1`
+	queryGetTokenState            = `SELECT u.token_generation, EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $2),
+			u.blocked_at IS NOT NULL
+		FROM users u WHERE u.login = $1`
+	queryDeleteExpiredTokens = `DELETE FROM revoked_tokens WHERE expires_at < now()`
+
+	querySetUserBlocked = `UPDATE users SET blocked_at = CASE WHEN $2 THEN COALESCE(blocked_at, now()) END
+		WHERE login = $1`
+	queryGrantUserRole  = `UPDATE users SET roles = array_append(array_remove(roles, $2), $2) WHERE login = $1`
+	queryRevokeUserRole = `UPDATE users SET roles = array_remove(roles, $2) WHERE login = $1`
+
+	querySaveAPIKey = `INSERT INTO api_keys (id, name, key_hash, scopes, created_by) VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at`
+	queryGetAPIKeys      = `SELECT id, name, key_hash, scopes, created_by, created_at, revoked_at FROM api_keys ORDER BY created_at`
+	queryGetAPIKeyByHash = `SELECT id, name, key_hash, scopes, created_by, created_at, revoked_at FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL`
+	queryRevokeAPIKey = `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, now()) WHERE id = $1`
+
+	querySavePasswordReset = `INSERT INTO password_resets (token_hash, login, expires_at) VALUES ($1, $2, $3)`
+	queryGetPasswordReset  = `SELECT token_hash, login, created_at, expires_at, used_at FROM password_resets
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()`
+	queryUsePasswordReset = `UPDATE password_resets SET used_at = now()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING login`
+	queryDeleteExpiredPasswordResets = `DELETE FROM password_resets WHERE expires_at < now()`
+
+	// loginFailures is the failures of the key in a row with the new one, the count starts over after the window
+	loginFailures = `(CASE WHEN a.updated_at < now() - make_interval(secs => $2) THEN 1 ELSE a.failures + 1 END)`
+	// queryAddLoginAttempt counts the attempt and locks the key out at the threshold in one statement, the lockout
+	// doubles for every failure over it, like usecase.LoginLimits.LockoutFor. A locked key isn't updated, no rows.
+	queryAddLoginAttempt = `INSERT INTO login_attempts AS a (key, failures, locked_until)
+		VALUES ($1, 1, CASE WHEN $3 = 1 THEN now() + make_interval(secs => LEAST($4, $5)) END)
+		ON CONFLICT (key) DO UPDATE
+			SET (failures, locked_until, updated_at) = (
+				` + loginFailures + `,
+				CASE WHEN $3 > 0 AND ` + loginFailures + ` >= $3 THEN now() + make_interval(secs =>
+					LEAST($4 * power(2, LEAST(` + loginFailures + ` - $3, 30)), $5)) END,
+				now())
+			WHERE a.locked_until IS NULL OR a.locked_until <= now()
+		RETURNING a.failures`
+	queryReleaseLoginAttempt = `UPDATE login_attempts
+		SET (failures, locked_until) = (
+			GREATEST(failures - 1, 0),
+			CASE WHEN failures - 1 < $2 THEN NULL ELSE locked_until END)
+		WHERE key = $1`
+	queryGetLoginLock       = `SELECT COALESCE(locked_until, 'epoch') FROM login_attempts WHERE key = $1`
+	queryResetLoginFailures = `DELETE FROM login_attempts WHERE key = $1`
+	// login attempts are kept a day after the last failure, it's longer than any sane failures window
+	queryDeleteStaleLoginAttempts = `DELETE FROM login_attempts
+		WHERE updated_at < now() - interval '1 day' AND (locked_until IS NULL OR locked_until < now())`
+
+	querySaveLedgerTransaction = `INSERT INTO ledger_entries
+			(transaction_id, account, login, order_id, type, amount, reason_code, comment, created_by)
+		SELECT t.id, e.account, $1, $2, $3, e.amount, $7, $8, $9
+		FROM (SELECT nextval('ledger_transaction_seq') AS id) t,
+			(VALUES ($4, $6::DECIMAL), ($5, -$6::DECIMAL)) e(account, amount)`
+	queryGetLedger = `SELECT id, transaction_id, account, login, COALESCE(order_id, '') AS order_id, type, amount,
+			COALESCE(reason_code, '') AS reason_code, COALESCE(comment, '') AS comment,
+			COALESCE(created_by, '') AS created_by, created_at
+		FROM ledger_entries
+		WHERE account = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3`
+	// queryReconcileBalances finds users whose balance counters drifted from the sums of their ledger entries.
+	queryReconcileBalances = `SELECT u.login, u.current, u.withdrawn,
+			COALESCE(SUM(l.amount), 0) AS ledger_current,
+			COALESCE(-SUM(l.amount) FILTER (WHERE l.type = 'WITHDRAWAL'), 0) AS ledger_withdrawn
+		FROM users u
+			LEFT JOIN ledger_entries l ON l.account = 'user:' || u.login
+		GROUP BY u.login, u.current, u.withdrawn
+		HAVING u.current <> COALESCE(SUM(l.amount), 0)
+			OR u.withdrawn <> COALESCE(-SUM(l.amount) FILTER (WHERE l.type = 'WITHDRAWAL'), 0)`
 )
 
 type pgRep struct {
@@ -74,26 +192,30 @@ func NewPGRepository(ctx context.Context, log *logger.Logger, addressDB string)
 	l.Println("debug l: start NewPGRepository")
 	log.Info("debug: start NewPGRepository")
 
-	db, err := sqlx.Connect("postgres", addressDB)
+	db, err := sqlx.ConnectContext(ctx, "postgres", addressDB)
 	if err != nil {
 		log.Fatal(fmt.Errorf("app - New - postgres.New: %w", err))
 	}
 
 	repositoryPG := pgRep{db: db, l: log}
-	if err = repositoryPG.init(ctx); err != nil {
+	if err = repositoryPG.init(); err != nil {
 		log.Fatal(fmt.Errorf("app - New - postgres.`Init`: %w", err))
 	}
 
 	return &repositoryPG
 }
 
-func (p *pgRep) init(ctx context.Context) error {
+// init applies the pending migrations. They don't run under the startup timeout: a migration rewriting
+// a big table may take longer, and a cancelled one is rolled back and retried on every start.
+func (p *pgRep) init() error {
 	p.l.Debug("start init")
 
-	_, err := p.db.ExecContext(ctx, queryCreateTables)
+	applied, err := migrations.Up(context.Background(), p.db)
 	if err != nil {
 		return err
 	}
+	p.l.Info("applied %d migration(s)", applied)
+
 	return nil
 }
 
@@ -124,7 +246,18 @@ func (p *pgRep) GetUser(ctx context.Context, login string) (entity.User, error)
 		ctx,
 		queryGetUser,
 		login,
-	).Scan(&user.Login, &user.Password, &user.Current, &user.Withdrawn)
+	).Scan(
+		&user.Login,
+		&user.Password,
+		&user.Current,
+		&user.Withdrawn,
+		&user.TokenGeneration,
+		pq.Array(&user.Roles),
+		&user.BlockedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.User{}, ErrUserLogin
+	}
 	if err != nil {
 		return entity.User{}, fmt.Errorf("error to get user: %w, %s", err, login)
 	}
@@ -132,13 +265,107 @@ func (p *pgRep) GetUser(ctx context.Context, login string) (entity.User, error)
 	return user, nil
 }
 
+func (p *pgRep) UpdatePassword(ctx context.Context, login, passwordHash string) error {
+	res, err := p.db.ExecContext(ctx, queryUpdatePassword, login, passwordHash)
+	if err != nil {
+		return fmt.Errorf("error to update password: %w, %s", err, login)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error to get rows after update password: %w, %s", err, login)
+	}
+	if rows <= 0 {
+		return ErrUserLogin
+	}
+
+	return nil
+}
+
+// CreateOrder saves a new order and reports false if an order with the same number already exists.
+func (p *pgRep) CreateOrder(ctx context.Context, order entity.Order) (bool, error) {
+	res, err := p.db.ExecContext(ctx, queryCreateOrder,
+		order.OrderID,
+		order.UserLogin,
+		order.Status,
+		time.Now().Format(time.RFC3339),
+		sql.NullString{String: order.APIKeyID, Valid: order.APIKeyID != ""},
+	)
+	if err != nil {
+		return false, fmt.Errorf("error to create order: %w, %+v", err, order)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error to get rows after create order: %w, %+v", err, order)
+	}
+
+	return rows > 0, nil
+}
+
+// CreateOrders creates the new orders of a batch in one transaction and returns the owners
+// of the orders that existed before.
+func (p *pgRep) CreateOrders(ctx context.Context, orders []entity.Order) (map[string]string, error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error to begin create orders: %w", err)
+	}
+	defer tx.Rollback()
+
+	uploadedAt := time.Now().Format(time.RFC3339)
+	owners := make(map[string]string)
+	for _, order := range orders {
+		res, err := tx.ExecContext(ctx, queryCreateOrder,
+			order.OrderID,
+			order.UserLogin,
+			order.Status,
+			uploadedAt,
+			sql.NullString{String: order.APIKeyID, Valid: order.APIKeyID != ""},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error to create order: %w, %+v", err, order)
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("error to get rows after create order: %w, %+v", err, order)
+		}
+		if rows > 0 {
+			continue
+		}
+
+		var existed entity.Order
+		err = tx.QueryRowContext(ctx, queryGetOrder, order.OrderID).
+			Scan(&existed.OrderID, &existed.UserLogin, &existed.Status, &existed.Accrual, &existed.UploadedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error to get existed order: %w, %s", err, order.OrderID)
+		}
+		owners[order.OrderID] = existed.UserLogin
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error to commit create orders: %w", err)
+	}
+
+	return owners, nil
+}
+
+// SaveOrder saves the order and credits its accrual to the user in one transaction.
+// The accrual is credited only once per order, on the first save with the PROCESSED status.
 func (p *pgRep) SaveOrder(ctx context.Context, order entity.Order) error {
-	res, err := p.db.ExecContext(ctx, querySaveOrder,
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error to begin save order: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, querySaveOrder,
 		order.OrderID,
 		order.UserLogin,
 		order.Status,
 		order.Accrual,
 		time.Now().Format(time.RFC3339),
+		repollDelay.Seconds(),
 	)
 	if err != nil {
 		return fmt.Errorf("error to save order: %w, %+v", err, order)
@@ -152,6 +379,20 @@ func (p *pgRep) SaveOrder(ctx context.Context, order entity.Order) error {
 		return fmt.Errorf("rows affected %v <= 0, after save order: %+v", rows, order)
 	}
 
+	if _, err = tx.ExecContext(ctx, queryAddOrderStatus, order.OrderID, order.Status); err != nil {
+		return fmt.Errorf("error to save order status history: %w, %+v", err, order)
+	}
+
+	if order.Status == completedStatus && order.Accrual != 0 {
+		if err = p.creditOrder(ctx, tx, order); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error to commit save order: %w, %+v", err, order)
+	}
+
 	p.l.Info("saved order: %+v", order)
 
 	return nil
@@ -165,6 +406,9 @@ func (p *pgRep) GetOrder(ctx context.Context, orderID string) (*entity.Order, er
 		queryGetOrder,
 		orderID,
 	).Scan(&order.OrderID, &order.UserLogin, &order.Status, &order.Accrual, &order.UploadedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &entity.Order{}, usecase.ErrUnknownOrder
+	}
 	if err != nil {
 		return &entity.Order{}, fmt.Errorf("error to get order: %w, %s", err, orderID)
 	}
@@ -174,49 +418,58 @@ func (p *pgRep) GetOrder(ctx context.Context, orderID string) (*entity.Order, er
 	return &order, nil
 }
 
-func (p *pgRep) GetOrders(ctx context.Context, login string) ([]entity.Orders, error) {
+func (p *pgRep) GetOrders(ctx context.Context, login string, filter entity.ListFilter) ([]entity.Orders, error) {
 	var result []entity.Orders
 
+	cursorTime, cursorID := cursorArgs(filter.Cursor)
 	err := p.db.SelectContext(
 		ctx,
 		&result,
 		queryGetOrders,
 		login,
+		pq.Array(filter.Statuses),
+		nullTime(filter.From),
+		nullTime(filter.To),
+		cursorTime,
+		cursorID,
+		nullLimit(filter.Limit),
 	)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error to get orders: %w, %s", err, login)
 	}
 
 	return result, nil
 }
 
-func (p *pgRep) UpdateUser(ctx context.Context, user entity.User) error {
-	res, err := p.db.ExecContext(ctx, queryUpdateUser,
-		user.Login,
-		user.Current,
-		user.Withdrawn,
-	)
-	if err != nil {
-		return fmt.Errorf("error to update user: %w, %+v", err, user)
-	}
+func (p *pgRep) GetOrderHistory(ctx context.Context, orderID string) ([]entity.OrderStatusChange, error) {
+	var result []entity.OrderStatusChange
 
-	rows, err := res.RowsAffected()
+	err := p.db.SelectContext(ctx, &result, queryGetOrderHistory, orderID)
 	if err != nil {
-		return fmt.Errorf("error to get rows after update user: %w, %+v", err, user)
-	}
-	if rows <= 0 {
-		return fmt.Errorf("rows affected %v <= 0, after update user: %+v", rows, user)
+		return nil, fmt.Errorf("error to get order status history: %w, %s", err, orderID)
 	}
 
-	return nil
+	return result, nil
 }
 
-func (p *pgRep) SupplementBalance(ctx context.Context, order entity.Order) error {
-	if order.Accrual == 0 {
+// creditOrder marks the order as credited and supplements the user balance, if it wasn't credited before.
+// The marker is set in the same transaction as the balance change, so a re-polled order is never credited twice.
+func (p *pgRep) creditOrder(ctx context.Context, tx *sqlx.Tx, order entity.Order) error {
+	res, err := tx.ExecContext(ctx, queryMarkOrderCredited, order.OrderID)
+	if err != nil {
+		return fmt.Errorf("error to mark order credited: %w, %+v", err, order)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error to get rows after mark order credited: %w, %+v", err, order)
+	}
+	if rows == 0 {
+		p.l.Info("order already credited: %s", order.OrderID)
 		return nil
 	}
 
-	res, err := p.db.ExecContext(ctx, querySupplementUser,
+	res, err = tx.ExecContext(ctx, querySupplementUser,
 		order.UserLogin,
 		order.Accrual,
 	)
@@ -224,7 +477,7 @@ func (p *pgRep) SupplementBalance(ctx context.Context, order entity.Order) error
 		return fmt.Errorf("error to supplement balance: %w, %+v", err, order)
 	}
 
-	rows, err := res.RowsAffected()
+	rows, err = res.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("error to get rows after supplement balance: %w, %+v", err, order)
 	}
@@ -232,15 +485,39 @@ func (p *pgRep) SupplementBalance(ctx context.Context, order entity.Order) error
 		return fmt.Errorf("rows affected %v <= 0, after supplement balance: %+v", rows, order)
 	}
 
-	return nil
+	return saveLedgerTransaction(ctx, tx, entity.LedgerEntry{
+		UserLogin: order.UserLogin,
+		OrderID:   order.OrderID,
+		Type:      entity.LedgerAccrual,
+		Amount:    order.Accrual,
+	})
 }
 
-func (p *pgRep) SaveWithdrawn(ctx context.Context, withdrawn entity.OrderWithdraw) error {
-	res, err := p.db.ExecContext(ctx, querySaveWithdrawn,
+// Withdraw checks the balance, debits the user and saves the withdrawn order in one transaction.
+// The user row is locked until commit, so concurrent withdrawals can't overdraw the account.
+// A repeated order number is reported as usecase.ErrWithdrawalExists before the balance is checked,
+// so a retried withdrawal isn't mistaken for a low balance.
+func (p *pgRep) Withdraw(ctx context.Context, withdrawn entity.OrderWithdraw) error {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error to begin withdraw: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current entity.Amount
+	err = tx.QueryRowContext(ctx, queryGetUserForUpdate, withdrawn.UserLogin).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserLogin
+	}
+	if err != nil {
+		return fmt.Errorf("error to get user for withdraw: %w, %s", err, withdrawn.UserLogin)
+	}
+
+	res, err := tx.ExecContext(ctx, querySaveWithdrawn,
 		withdrawn.OrderID,
 		withdrawn.UserLogin,
 		withdrawn.Value,
-		withdrawn.ProcessedAt,
+		time.Now().Format(time.RFC3339),
 	)
 	if err != nil {
 		return fmt.Errorf("error to save withdrawn: %w, %+v", err, withdrawn)
@@ -251,42 +528,657 @@ func (p *pgRep) SaveWithdrawn(ctx context.Context, withdrawn entity.OrderWithdra
 		return fmt.Errorf("error to get rows after save withdrawn: %w, %+v", err, withdrawn)
 	}
 	if rows <= 0 {
-		return fmt.Errorf("rows affected %v <= 0, after save withdrawn: %+v", rows, withdrawn)
+		return usecase.ErrWithdrawalExists
 	}
 
-	return nil
+	if withdrawn.Value > current {
+		return usecase.ErrLowBalance
+	}
+
+	_, err = tx.ExecContext(ctx, queryWithdrawUser,
+		withdrawn.UserLogin,
+		withdrawn.Value,
+	)
+	if err != nil {
+		return fmt.Errorf("error to withdraw user balance: %w, %+v", err, withdrawn)
+	}
+
+	err = saveLedgerTransaction(ctx, tx, entity.LedgerEntry{
+		UserLogin: withdrawn.UserLogin,
+		OrderID:   withdrawn.OrderID,
+		Type:      entity.LedgerWithdrawal,
+		Amount:    withdrawn.Value.Neg(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (p *pgRep) GetWithdrawals(ctx context.Context, login string) ([]entity.OrderWithdraw, error) {
+// Adjust credits or debits the user balance by support in one transaction. Like Withdraw it locks
+// the user row and refuses a debit over the current balance.
+func (p *pgRep) Adjust(ctx context.Context, adjustment entity.Adjustment) error {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error to begin adjust: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current entity.Amount
+	err = tx.QueryRowContext(ctx, queryGetUserForUpdate, adjustment.UserLogin).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserLogin
+	}
+	if err != nil {
+		return fmt.Errorf("error to get user for adjust: %w, %s", err, adjustment.UserLogin)
+	}
+
+	balance, err := current.Add(adjustment.Amount)
+	if err != nil {
+		return err
+	}
+	if balance < 0 {
+		return usecase.ErrLowBalance
+	}
+
+	_, err = tx.ExecContext(ctx, querySupplementUser,
+		adjustment.UserLogin,
+		adjustment.Amount,
+	)
+	if err != nil {
+		return fmt.Errorf("error to adjust user balance: %w, %+v", err, adjustment)
+	}
+
+	err = saveLedgerTransaction(ctx, tx, entity.LedgerEntry{
+		UserLogin:  adjustment.UserLogin,
+		Type:       entity.LedgerAdjustment,
+		Amount:     adjustment.Amount,
+		ReasonCode: adjustment.ReasonCode,
+		Comment:    adjustment.Comment,
+		CreatedBy:  adjustment.CreatedBy,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *pgRep) GetWithdrawals(
+	ctx context.Context,
+	login string,
+	filter entity.ListFilter,
+) ([]entity.OrderWithdraw, error) {
 	var result []entity.OrderWithdraw
 
+	cursorTime, cursorID := cursorArgs(filter.Cursor)
 	err := p.db.SelectContext(
 		ctx,
 		&result,
 		queryGetWithdrawals,
 		login,
+		nullTime(filter.From),
+		nullTime(filter.To),
+		cursorTime,
+		cursorID,
+		nullLimit(filter.Limit),
 	)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error to get withdrawals: %w, %s", err, login)
 	}
 
 	return result, nil
 }
 
-func (p *pgRep) GetOrderForUpdate(ctx context.Context) (*entity.Order, error) {
-	var order entity.Order
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
 
-	err := p.db.QueryRowContext(
+func nullLimit(limit int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(limit), Valid: limit > 0}
+}
+
+func cursorArgs(cursor *entity.Cursor) (sql.NullTime, string) {
+	if cursor == nil {
+		return sql.NullTime{}, ""
+	}
+
+	return nullTime(cursor.Time), cursor.OrderID
+}
+
+func (p *pgRep) GetLedger(ctx context.Context, login string, limit, offset int) ([]entity.LedgerEntry, error) {
+	var result []entity.LedgerEntry
+
+	err := p.db.SelectContext(
 		ctx,
-		queryGetOrderForUpdate,
-		completedStatus,
-	).Scan(&order.OrderID, &order.UserLogin, &order.Status, &order.Accrual, &order.UploadedAt)
+		&result,
+		queryGetLedger,
+		entity.UserAccount(login),
+		limit,
+		offset,
+	)
 	if err != nil {
-		return &entity.Order{}, fmt.Errorf("error to get order for update: %w", err)
+		return nil, fmt.Errorf("error to get ledger: %w, %s", err, login)
 	}
-	p.l.Info("order for update: %+v", order)
 
-	return &order, nil
+	return result, nil
+}
+
+// ReconcileBalances compares the balance counters of every user with the sums of the user's ledger entries.
+func (p *pgRep) ReconcileBalances(ctx context.Context) ([]entity.BalanceDrift, error) {
+	var result []entity.BalanceDrift
+
+	if err := p.db.SelectContext(ctx, &result, queryReconcileBalances); err != nil {
+		return nil, fmt.Errorf("error to reconcile balances: %w", err)
+	}
+
+	return result, nil
+}
+
+// RetryOrder releases the claimed order after a failed poll and schedules the next one.
+func (p *pgRep) RetryOrder(ctx context.Context, retry entity.OrderRetry) error {
+	res, err := p.db.ExecContext(ctx, queryRetryOrder,
+		retry.OrderID,
+		retry.Attempts,
+		retry.NextPollAt,
+		retry.LastError,
+		retry.DeadLetter,
+	)
+	if err != nil {
+		return fmt.Errorf("error to retry order: %w, %+v", err, retry)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error to get rows after retry order: %w, %+v", err, retry)
+	}
+	if rows <= 0 {
+		return fmt.Errorf("rows affected %v <= 0, after retry order: %+v", rows, retry)
+	}
+
+	return nil
+}
+
+// GetOrdersForUpdate claims up to limit of the pending orders that are due to poll for claimLease.
+// INVALID and PROCESSED orders are final and dead-lettered orders are left for operators.
+// Rows locked by a concurrent claim are skipped, so several replicas never get the same order.
+func (p *pgRep) GetOrdersForUpdate(ctx context.Context, limit int) ([]entity.Order, error) {
+	var result []entity.Order
+
+	err := p.db.SelectContext(
+		ctx,
+		&result,
+		queryClaimOrdersForUpdate,
+		limit,
+		claimLease.Seconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error to get orders for update: %w", err)
+	}
+	p.l.Debug("orders for update: %d", len(result))
+
+	return result, nil
+}
+
+func (p *pgRep) SaveSession(ctx context.Context, session entity.Session) error {
+	_, err := p.db.ExecContext(ctx, querySaveSession,
+		session.ID,
+		session.FamilyID,
+		session.UserLogin,
+		session.RefreshTokenHash,
+		session.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error to save session: %w, %s", err, session.ID)
+	}
+
+	return nil
+}
+
+// RotateSession replaces the session of the refresh token hash with the next one of the same family.
+// A rotated or revoked session means the refresh token was reused, then the whole family is revoked.
+func (p *pgRep) RotateSession(ctx context.Context, refreshTokenHash string, next entity.Session) (entity.Session, error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return entity.Session{}, fmt.Errorf("error to begin rotate session: %w", err)
+	}
+	defer tx.Rollback()
+
+	var session entity.Session
+	err = tx.GetContext(ctx, &session, queryGetSessionForUpdate, refreshTokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.Session{}, usecase.ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return entity.Session{}, fmt.Errorf("error to get session: %w", err)
+	}
+
+	if session.RotatedAt != nil || session.RevokedAt != nil {
+		if _, err = tx.ExecContext(ctx, queryRevokeSessionFamily, session.FamilyID); err != nil {
+			return entity.Session{}, fmt.Errorf("error to revoke session family: %w, %s", err, session.FamilyID)
+		}
+		if err = tx.Commit(); err != nil {
+			return entity.Session{}, err
+		}
+		return entity.Session{}, usecase.ErrRefreshTokenReused
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		return entity.Session{}, usecase.ErrInvalidRefreshToken
+	}
+
+	if _, err = tx.ExecContext(ctx, queryRotateSession, session.ID); err != nil {
+		return entity.Session{}, fmt.Errorf("error to rotate session: %w, %s", err, session.ID)
+	}
+
+	next.FamilyID, next.UserLogin = session.FamilyID, session.UserLogin
+	_, err = tx.ExecContext(ctx, querySaveSession,
+		next.ID,
+		next.FamilyID,
+		next.UserLogin,
+		next.RefreshTokenHash,
+		next.ExpiresAt,
+	)
+	if err != nil {
+		return entity.Session{}, fmt.Errorf("error to save session: %w, %s", err, next.ID)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return entity.Session{}, fmt.Errorf("error to commit rotate session: %w", err)
+	}
+
+	return next, nil
+}
+
+func (p *pgRep) RevokeSessionFamily(ctx context.Context, familyID string) error {
+	_, err := p.db.ExecContext(ctx, queryRevokeSessionFamily, familyID)
+	if err != nil {
+		return fmt.Errorf("error to revoke session family: %w, %s", err, familyID)
+	}
+
+	return nil
+}
+
+// RevokeToken adds the access token to the denylist until it expires.
+func (p *pgRep) RevokeToken(ctx context.Context, identity entity.Identity) error {
+	_, err := p.db.ExecContext(ctx, queryRevokeToken,
+		identity.TokenID,
+		identity.Login,
+		identity.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error to revoke token: %w, %s", err, identity.TokenID)
+	}
+
+	return nil
+}
+
+// RevokeUserTokens bumps the user token generation and revokes all user sessions in one transaction,
+// so every access and refresh token issued before becomes invalid.
+func (p *pgRep) RevokeUserTokens(ctx context.Context, login string) error {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error to begin revoke user tokens: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err = revokeUserTokens(ctx, tx, login); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ChangePassword saves the new password hash and revokes all user tokens in one transaction.
+func (p *pgRep) ChangePassword(ctx context.Context, login, passwordHash string) error {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error to begin change password: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, queryUpdatePassword, login, passwordHash); err != nil {
+		return fmt.Errorf("error to update password: %w, %s", err, login)
+	}
+
+	if err = revokeUserTokens(ctx, tx, login); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *pgRep) SavePasswordReset(ctx context.Context, reset entity.PasswordReset) error {
+	_, err := p.db.ExecContext(ctx, querySavePasswordReset,
+		reset.TokenHash,
+		reset.UserLogin,
+		reset.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("error to save password reset: %w, %s", err, reset.UserLogin)
+	}
+
+	return nil
+}
+
+// GetPasswordReset returns the reset by the token hash if it's neither used nor expired.
+func (p *pgRep) GetPasswordReset(ctx context.Context, tokenHash string) (entity.PasswordReset, error) {
+	var reset entity.PasswordReset
+
+	err := p.db.GetContext(ctx, &reset, queryGetPasswordReset, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.PasswordReset{}, usecase.ErrInvalidResetToken
+	}
+	if err != nil {
+		return entity.PasswordReset{}, fmt.Errorf("error to get password reset: %w", err)
+	}
+
+	return reset, nil
+}
+
+// ResetPassword uses the reset token, saves the new password hash and revokes all user tokens
+// in one transaction. It returns the login of the user.
+func (p *pgRep) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (string, error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("error to begin reset password: %w", err)
+	}
+	defer tx.Rollback()
+
+	var login string
+	err = tx.GetContext(ctx, &login, queryUsePasswordReset, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", usecase.ErrInvalidResetToken
+	}
+	if err != nil {
+		return "", fmt.Errorf("error to use password reset: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, queryUpdatePassword, login, passwordHash); err != nil {
+		return "", fmt.Errorf("error to update password: %w, %s", err, login)
+	}
+
+	if err = revokeUserTokens(ctx, tx, login); err != nil {
+		return "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return "", fmt.Errorf("error to commit reset password: %w", err)
+	}
+
+	return login, nil
+}
+
+// GetTokenState returns the current token generation of the user, whether the token is in the denylist
+// and whether the user is blocked.
+func (p *pgRep) GetTokenState(ctx context.Context, login, tokenID string) (entity.TokenState, error) {
+	var state entity.TokenState
+
+	err := p.db.QueryRowContext(ctx, queryGetTokenState, login, tokenID).Scan(
+		&state.Generation,
+		&state.Revoked,
+		&state.Blocked,
+	)
+	if err != nil {
+		return entity.TokenState{}, fmt.Errorf("error to get token state: %w, %s", err, login)
+	}
+
+	return state, nil
+}
+
+// SetUserBlocked blocks or unblocks the user. Blocking also revokes all user tokens in the same transaction.
+func (p *pgRep) SetUserBlocked(ctx context.Context, login string, blocked bool) error {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error to begin set user blocked: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, querySetUserBlocked, login, blocked)
+	if err != nil {
+		return fmt.Errorf("error to set user blocked: %w, %s", err, login)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error to get rows after set user blocked: %w, %s", err, login)
+	}
+	if rows <= 0 {
+		return ErrUserLogin
+	}
+
+	if blocked {
+		if err = revokeUserTokens(ctx, tx, login); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SetUserRole grants or revokes the role. All user tokens are revoked in the same transaction,
+// so no token carries the previous roles.
+func (p *pgRep) SetUserRole(ctx context.Context, login, role string, granted bool) error {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error to begin set user role: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := queryRevokeUserRole
+	if granted {
+		query = queryGrantUserRole
+	}
+	if _, err = tx.ExecContext(ctx, query, login, role); err != nil {
+		return fmt.Errorf("error to set user role: %w, %s", err, login)
+	}
+
+	if err = revokeUserTokens(ctx, tx, login); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteExpiredTokens removes expired denylist entries, sessions, password resets and stale login attempts
+// and returns how many rows were removed.
+func (p *pgRep) DeleteExpiredTokens(ctx context.Context) (int64, error) {
+	var deleted int64
+	queries := []string{
+		queryDeleteExpiredTokens,
+		queryDeleteExpiredSessions,
+		queryDeleteExpiredPasswordResets,
+		queryDeleteStaleLoginAttempts,
+	}
+	for _, query := range queries {
+		res, err := p.db.ExecContext(ctx, query)
+		if err != nil {
+			return deleted, fmt.Errorf("error to delete expired tokens: %w", err)
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return deleted, fmt.Errorf("error to get rows after delete expired tokens: %w", err)
+		}
+		deleted += rows
+	}
+
+	return deleted, nil
+}
+
+// AddLoginAttempt counts the attempt of the key as a failure and locks the key out if it's over the limits.
+// If the key is already locked out, the attempt isn't counted and the lockout end is returned.
+func (p *pgRep) AddLoginAttempt(ctx context.Context, key string, limits usecase.LoginLimits) (time.Time, error) {
+	var failures int
+
+	err := p.db.GetContext(ctx, &failures, queryAddLoginAttempt, key, limits.Window.Seconds(),
+		limits.MaxAttempts, limits.Lockout.Seconds(), limits.MaxLockout.Seconds())
+	if err == nil {
+		return time.Time{}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, fmt.Errorf("error to add login attempt: %w, %s", err, key)
+	}
+
+	var lockedUntil time.Time
+	if err = p.db.GetContext(ctx, &lockedUntil, queryGetLoginLock, key); err != nil {
+		return time.Time{}, fmt.Errorf("error to get login lock: %w, %s", err, key)
+	}
+
+	return lockedUntil, nil
+}
+
+// ReleaseLoginAttempt takes back the attempt counted in advance, the lockout it has caused is lifted.
+func (p *pgRep) ReleaseLoginAttempt(ctx context.Context, key string, limits usecase.LoginLimits) error {
+	_, err := p.db.ExecContext(ctx, queryReleaseLoginAttempt, key, limits.MaxAttempts)
+	if err != nil {
+		return fmt.Errorf("error to release login attempt: %w, %s", err, key)
+	}
+
+	return nil
+}
+
+func (p *pgRep) ResetLoginFailures(ctx context.Context, key string) error {
+	_, err := p.db.ExecContext(ctx, queryResetLoginFailures, key)
+	if err != nil {
+		return fmt.Errorf("error to reset login failures: %w, %s", err, key)
+	}
+
+	return nil
+}
+
+// SaveAPIKey saves the key and returns it with the creation time.
+func (p *pgRep) SaveAPIKey(ctx context.Context, key entity.APIKey) (entity.APIKey, error) {
+	err := p.db.QueryRowContext(ctx, querySaveAPIKey,
+		key.ID,
+		key.Name,
+		key.KeyHash,
+		pq.Array(key.Scopes),
+		key.CreatedBy,
+	).Scan(&key.CreatedAt)
+	if err != nil {
+		return entity.APIKey{}, fmt.Errorf("error to save api key: %w, %s", err, key.Name)
+	}
+
+	return key, nil
+}
+
+func (p *pgRep) GetAPIKeys(ctx context.Context) ([]entity.APIKey, error) {
+	rows, err := p.db.QueryContext(ctx, queryGetAPIKeys)
+	if err != nil {
+		return nil, fmt.Errorf("error to get api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var result []entity.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error to scan api key: %w", err)
+		}
+		result = append(result, key)
+	}
+
+	return result, rows.Err()
+}
+
+// GetAPIKeyByHash returns the not revoked key by the key hash.
+func (p *pgRep) GetAPIKeyByHash(ctx context.Context, keyHash string) (entity.APIKey, error) {
+	key, err := scanAPIKey(p.db.QueryRowContext(ctx, queryGetAPIKeyByHash, keyHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return entity.APIKey{}, usecase.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return entity.APIKey{}, fmt.Errorf("error to get api key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (p *pgRep) RevokeAPIKey(ctx context.Context, id string) error {
+	res, err := p.db.ExecContext(ctx, queryRevokeAPIKey, id)
+	if err != nil {
+		return fmt.Errorf("error to revoke api key: %w, %s", err, id)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error to get rows after revoke api key: %w, %s", err, id)
+	}
+	if rows <= 0 {
+		return usecase.ErrUnknownAPIKey
+	}
+
+	return nil
+}
+
+// rowScanner is *sql.Row or *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAPIKey scans scopes with pq.Array, sqlx can't map TEXT[] to []string by itself.
+func scanAPIKey(row rowScanner) (entity.APIKey, error) {
+	var key entity.APIKey
+
+	err := row.Scan(
+		&key.ID,
+		&key.Name,
+		&key.KeyHash,
+		pq.Array(&key.Scopes),
+		&key.CreatedBy,
+		&key.CreatedAt,
+		&key.RevokedAt,
+	)
+
+	return key, err
+}
+
+// revokeUserTokens bumps the user token generation and revokes all user sessions in the given transaction.
+func revokeUserTokens(ctx context.Context, tx *sqlx.Tx, login string) error {
+	res, err := tx.ExecContext(ctx, queryIncrementTokenGeneration, login)
+	if err != nil {
+		return fmt.Errorf("error to increment token generation: %w, %s", err, login)
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error to get rows after increment token generation: %w, %s", err, login)
+	}
+	if rows <= 0 {
+		return ErrUserLogin
+	}
+
+	if _, err = tx.ExecContext(ctx, queryRevokeUserSessions, login); err != nil {
+		return fmt.Errorf("error to revoke user sessions: %w, %s", err, login)
+	}
+
+	return nil
+}
+
+// saveLedgerTransaction writes the user side of the entry and the balancing system side in the given transaction.
+func saveLedgerTransaction(ctx context.Context, tx *sqlx.Tx, entry entity.LedgerEntry) error {
+	nullString := func(value string) sql.NullString {
+		return sql.NullString{String: value, Valid: value != ""}
+	}
+
+	_, err := tx.ExecContext(ctx, querySaveLedgerTransaction,
+		entry.UserLogin,
+		nullString(entry.OrderID),
+		entry.Type,
+		entity.UserAccount(entry.UserLogin),
+		entity.SystemAccount(entry.Type),
+		entry.Amount,
+		nullString(entry.ReasonCode),
+		nullString(entry.Comment),
+		nullString(entry.CreatedBy),
+	)
+	if err != nil {
+		return fmt.Errorf("error to save ledger transaction: %w, %+v", err, entry)
+	}
+
+	return nil
 }
 
 func (p *pgRep) Close() {
@@ -0,0 +1,118 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+)
+
+//go:generate mockery --name Admin
+
+var ErrUnknownRole = errors.New("unknown role")
+
+const maxCommentLength = 1000
+
+var knownRoles = map[string]struct{}{entity.RoleAdmin: {}}
+
+var reasonCodes = map[string]struct{}{
+	entity.ReasonGoodwill:    {},
+	entity.ReasonCorrection:  {},
+	entity.ReasonLostAccrual: {},
+	entity.ReasonFraud:       {},
+	entity.ReasonOther:       {},
+}
+
+type adminService struct {
+	repo AdminRepository
+}
+
+// Admin is the account management of support staff.
+type Admin interface {
+	GetAccount(ctx context.Context, login string) (entity.Account, error)
+	BlockUser(ctx context.Context, login string) error
+	UnblockUser(ctx context.Context, login string) error
+	SetRole(ctx context.Context, login, role string, granted bool) error
+	Adjust(ctx context.Context, adjustment entity.Adjustment) (entity.Account, error)
+}
+
+type AdminRepository interface {
+	GetUser(ctx context.Context, login string) (entity.User, error)
+	SetUserBlocked(ctx context.Context, login string, blocked bool) error
+	SetUserRole(ctx context.Context, login, role string, granted bool) error
+	Adjust(ctx context.Context, adjustment entity.Adjustment) error
+}
+
+func NewAdmin(repo AdminRepository) *adminService {
+	return &adminService{repo: repo}
+}
+
+func (s *adminService) GetAccount(ctx context.Context, login string) (entity.Account, error) {
+	user, err := s.repo.GetUser(ctx, login)
+	if err != nil {
+		return entity.Account{}, err
+	}
+
+	roles := user.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+
+	return entity.Account{
+		Login:     user.Login,
+		Roles:     roles,
+		BlockedAt: user.BlockedAt,
+		Current:   user.Current,
+		Withdrawn: user.Withdrawn,
+	}, nil
+}
+
+// BlockUser blocks the user and revokes all tokens, so the user is logged out everywhere at once.
+func (s *adminService) BlockUser(ctx context.Context, login string) error {
+	return s.repo.SetUserBlocked(ctx, login, true)
+}
+
+func (s *adminService) UnblockUser(ctx context.Context, login string) error {
+	return s.repo.SetUserBlocked(ctx, login, false)
+}
+
+// SetRole grants or revokes the role, the user has to log in again to get it in the token.
+func (s *adminService) SetRole(ctx context.Context, login, role string, granted bool) error {
+	if _, ok := knownRoles[role]; !ok {
+		return ErrUnknownRole
+	}
+
+	return s.repo.SetUserRole(ctx, login, role, granted)
+}
+
+// Adjust credits or debits the user balance and returns the account after it. It returns *ValidationError
+// for a zero amount, an unknown reason code or an empty comment and ErrLowBalance for a debit over the balance.
+func (s *adminService) Adjust(ctx context.Context, adjustment entity.Adjustment) (entity.Account, error) {
+	adjustment.Comment = strings.TrimSpace(adjustment.Comment)
+
+	fields := make(map[string]string)
+	if adjustment.Amount == 0 {
+		fields["amount"] = "amount must be positive to credit or negative to debit"
+	}
+	if _, ok := reasonCodes[adjustment.ReasonCode]; !ok {
+		fields["reason_code"] = "unknown reason code"
+	}
+	switch {
+	case adjustment.Comment == "":
+		fields["comment"] = "comment is required"
+	case utf8.RuneCountInString(adjustment.Comment) > maxCommentLength:
+		fields["comment"] = fmt.Sprintf("comment must be at most %d characters", maxCommentLength)
+	}
+	if len(fields) > 0 {
+		return entity.Account{}, &ValidationError{Fields: fields}
+	}
+
+	if err := s.repo.Adjust(ctx, adjustment); err != nil {
+		return entity.Account{}, err
+	}
+
+	return s.GetAccount(ctx, adjustment.UserLogin)
+}
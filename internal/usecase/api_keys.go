@@ -0,0 +1,148 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+)
+
+//go:generate mockery --name APIKeys
+
+const (
+	apiKeyPrefix       = "gm_"
+	apiKeyIDLength     = 8
+	apiKeySecretLength = 32
+	maxAPIKeyNameLen   = 128
+)
+
+var (
+	ErrInvalidAPIKey = errors.New("invalid or revoked api key")
+	ErrUnknownAPIKey = errors.New("unknown api key")
+)
+
+var apiKeyScopes = map[string]struct{}{
+	entity.ScopeOrdersWrite: {},
+	entity.ScopeOrdersRead:  {},
+	entity.ScopeBalanceRead: {},
+}
+
+type apiKeysService struct {
+	repo APIKeysRepository
+}
+
+// APIKeys manages keys of partner services, which act on behalf of users within the key scopes.
+type APIKeys interface {
+	Create(ctx context.Context, name string, scopes []string, createdBy string) (entity.APIKey, string, error)
+	List(ctx context.Context) ([]entity.APIKey, error)
+	Revoke(ctx context.Context, id string) error
+	Authenticate(ctx context.Context, key string) (entity.APIKey, error)
+}
+
+type APIKeysRepository interface {
+	SaveAPIKey(ctx context.Context, key entity.APIKey) (entity.APIKey, error)
+	GetAPIKeys(ctx context.Context) ([]entity.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (entity.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+}
+
+func NewAPIKeys(repo APIKeysRepository) *apiKeysService {
+	return &apiKeysService{repo: repo}
+}
+
+// Create returns the saved key and the key itself, it's shown only once and can't be restored.
+func (s *apiKeysService) Create(
+	ctx context.Context,
+	name string,
+	scopes []string,
+	createdBy string,
+) (entity.APIKey, string, error) {
+	name = strings.TrimSpace(name)
+
+	fields := make(map[string]string)
+	switch {
+	case name == "":
+		fields["name"] = "name is required"
+	case utf8.RuneCountInString(name) > maxAPIKeyNameLen:
+		fields["name"] = fmt.Sprintf("name must be at most %d characters", maxAPIKeyNameLen)
+	}
+	scopes, unknown := uniqueScopes(scopes)
+	switch {
+	case len(unknown) > 0:
+		fields["scopes"] = "unknown scopes " + strings.Join(unknown, ", ")
+	case len(scopes) == 0:
+		fields["scopes"] = "at least one scope is required"
+	}
+	if len(fields) > 0 {
+		return entity.APIKey{}, "", &ValidationError{Fields: fields}
+	}
+
+	idBytes := make([]byte, apiKeyIDLength)
+	if _, err := rand.Read(idBytes); err != nil {
+		return entity.APIKey{}, "", fmt.Errorf("error to generate api key id: %w", err)
+	}
+	id := hex.EncodeToString(idBytes)
+
+	secret, err := randomToken(apiKeySecretLength)
+	if err != nil {
+		return entity.APIKey{}, "", err
+	}
+	key := apiKeyPrefix + id + "_" + secret
+
+	saved, err := s.repo.SaveAPIKey(ctx, entity.APIKey{
+		ID:        id,
+		Name:      name,
+		KeyHash:   hashToken(key),
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+	})
+	if err != nil {
+		return entity.APIKey{}, "", err
+	}
+
+	return saved, key, nil
+}
+
+func (s *apiKeysService) List(ctx context.Context) ([]entity.APIKey, error) {
+	return s.repo.GetAPIKeys(ctx)
+}
+
+func (s *apiKeysService) Revoke(ctx context.Context, id string) error {
+	return s.repo.RevokeAPIKey(ctx, id)
+}
+
+// Authenticate returns the not revoked key, ErrInvalidAPIKey otherwise.
+func (s *apiKeysService) Authenticate(ctx context.Context, key string) (entity.APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return entity.APIKey{}, ErrInvalidAPIKey
+	}
+
+	return s.repo.GetAPIKeyByHash(ctx, hashToken(key))
+}
+
+// uniqueScopes drops the repeated scopes keeping the order and returns the quoted unknown ones apart.
+func uniqueScopes(scopes []string) ([]string, []string) {
+	seen := make(map[string]struct{}, len(scopes))
+	unique := make([]string, 0, len(scopes))
+	var unknown []string
+	for _, scope := range scopes {
+		if _, ok := seen[scope]; ok {
+			continue
+		}
+		seen[scope] = struct{}{}
+
+		if _, ok := apiKeyScopes[scope]; !ok {
+			unknown = append(unknown, strconv.Quote(scope))
+			continue
+		}
+		unique = append(unique, scope)
+	}
+
+	return unique, unknown
+}
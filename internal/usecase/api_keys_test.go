@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+)
+
+// savingAPIKeysRepo returns the key as saved, the rest isn't used by Create.
+type savingAPIKeysRepo struct {
+	APIKeysRepository
+}
+
+func (savingAPIKeysRepo) SaveAPIKey(ctx context.Context, key entity.APIKey) (entity.APIKey, error) {
+	return key, nil
+}
+
+func TestAPIKeysCreateScopes(t *testing.T) {
+	s := NewAPIKeys(savingAPIKeysRepo{})
+
+	tests := []struct {
+		name       string
+		scopes     []string
+		wantScopes []string
+		// wantFields maps the invalid fields to a part of their message
+		wantFields map[string]string
+	}{
+		{name: "one scope", scopes: []string{entity.ScopeOrdersWrite},
+			wantScopes: []string{entity.ScopeOrdersWrite}},
+		{name: "repeated scopes", scopes: []string{entity.ScopeBalanceRead, entity.ScopeOrdersWrite, entity.ScopeBalanceRead},
+			wantScopes: []string{entity.ScopeBalanceRead, entity.ScopeOrdersWrite}},
+		{name: "no scopes", scopes: nil,
+			wantFields: map[string]string{"scopes": "at least one scope is required"}},
+		{name: "every unknown scope", scopes: []string{"orders:delete", entity.ScopeOrdersRead, "admin", "admin"},
+			wantFields: map[string]string{"scopes": `unknown scopes "orders:delete", "admin"`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, secret, err := s.Create(context.Background(), "partner", tt.scopes, "admin")
+			assertValidationFields(t, err, tt.wantFields)
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(key.Scopes, tt.wantScopes) {
+				t.Errorf("scopes = %v, want %v", key.Scopes, tt.wantScopes)
+			}
+			if secret == "" || key.KeyHash != hashToken(secret) {
+				t.Errorf("key hash %q isn't the hash of the key %q", key.KeyHash, secret)
+			}
+		})
+	}
+}
@@ -2,98 +2,369 @@ package usecase
 
 import (
 	"context"
-	"crypto/sha1"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"time"
 
 	"github.com/IgorAleksandroff/gophermart/internal/entity"
+	"github.com/IgorAleksandroff/gophermart/pkg/logger"
 	"github.com/golang-jwt/jwt/v4"
 )
 
 //go:generate mockery --name Authorization
 //go:generate mockery --name AuthorizationRepository
 
+// LegacySalt was used by the SHA-1 password hashes of the first releases, see hasher.NewLegacySHA1.
+const LegacySalt = "hjjrhjqw134617ajfhajs"
+
 const (
-	salt     = "hjjrhjqw134617ajfhajs"
-	key      = "qlkjk#4#%35FSFJlja#4253KSFjH"
-	tokenTTL = time.Hour
+	tokenType          = "Bearer"
+	refreshTokenLength = 32
 )
 
 var ErrUserLogin = errors.New("invalid password or login")
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+var ErrRefreshTokenReused = errors.New("refresh token reused, all tokens of the session are revoked")
+var ErrTokenRevoked = errors.New("token is revoked")
+var ErrWrongPassword = errors.New("wrong password")
+var ErrUserBlocked = errors.New("user is blocked")
 
 type authService struct {
-	repo UserRepository
+	repo            UserRepository
+	hasher          PasswordHasher
+	policy          CredentialsPolicy
+	keys            TokenKeys
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	l               *logger.Logger
 }
 
 type Authorization interface {
 	CreateUser(ctx context.Context, user entity.User) error
-	GenerateToken(ctx context.Context, username, password string) (string, error)
-	ParseToken(token string) (string, error)
+	GenerateToken(ctx context.Context, username, password string) (entity.Tokens, error)
+	RefreshToken(ctx context.Context, refreshToken string) (entity.Tokens, error)
+	ChangePassword(ctx context.Context, login, oldPassword, newPassword string) (entity.Tokens, error)
+	ParseToken(token string) (entity.Identity, error)
+	Identify(ctx context.Context, token string) (entity.Identity, error)
+	Logout(ctx context.Context, identity entity.Identity) error
+	LogoutAll(ctx context.Context, login string) error
+	CleanupExpired(ctx context.Context) (int64, error)
 }
 
 type UserRepository interface {
 	SaveUser(ctx context.Context, user entity.User) error
 	GetUser(ctx context.Context, login string) (entity.User, error)
+	UpdatePassword(ctx context.Context, login, passwordHash string) error
+	ChangePassword(ctx context.Context, login, passwordHash string) error
+	SaveSession(ctx context.Context, session entity.Session) error
+	RotateSession(ctx context.Context, refreshTokenHash string, next entity.Session) (entity.Session, error)
+	RevokeSessionFamily(ctx context.Context, familyID string) error
+	RevokeToken(ctx context.Context, identity entity.Identity) error
+	RevokeUserTokens(ctx context.Context, login string) error
+	GetTokenState(ctx context.Context, login, tokenID string) (entity.TokenState, error)
+	DeleteExpiredTokens(ctx context.Context) (int64, error)
+}
+
+type TokenKeys interface {
+	Sign(claims jwt.Claims) (string, error)
+	Keyfunc(token *jwt.Token) (interface{}, error)
+}
+
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Compare(hash, password string) (bool, error)
+	NeedsRehash(hash string) bool
 }
 
 type tokenClaims struct {
 	jwt.RegisteredClaims
-	UserLogin string `json:"login"`
+	UserLogin  string   `json:"login"`
+	Roles      []string `json:"roles,omitempty"`
+	SessionID  string   `json:"sid,omitempty"`
+	Generation int      `json:"gen"`
 }
 
-func NewAuthorization(repo UserRepository) *authService {
-	return &authService{repo: repo}
+func NewAuthorization(
+	repo UserRepository,
+	hasher PasswordHasher,
+	policy CredentialsPolicy,
+	keys TokenKeys,
+	accessTokenTTL, refreshTokenTTL time.Duration,
+	l *logger.Logger,
+) *authService {
+	return &authService{
+		repo:            repo,
+		hasher:          hasher,
+		policy:          policy,
+		keys:            keys,
+		accessTokenTTL:  accessTokenTTL,
+		refreshTokenTTL: refreshTokenTTL,
+		l:               l,
+	}
 }
 
+// CreateUser returns *ValidationError if the credentials break the policy.
 func (s *authService) CreateUser(ctx context.Context, user entity.User) error {
-	user.Password = generatePasswordHash(user.Password)
+	if err := s.policy.ValidateUser(user); err != nil {
+		return err
+	}
+
+	passwordHash, err := s.hasher.Hash(user.Password)
+	if err != nil {
+		return fmt.Errorf("error to hash password: %w", err)
+	}
+
+	user.Password = passwordHash
 	return s.repo.SaveUser(ctx, user)
 }
 
-func (s *authService) GenerateToken(ctx context.Context, username, password string) (string, error) {
+// GenerateToken checks the password and starts a new session: a short-lived access token and a refresh token.
+func (s *authService) GenerateToken(ctx context.Context, username, password string) (entity.Tokens, error) {
 	user, err := s.repo.GetUser(ctx, username)
 	if err != nil {
-		return "", err
+		return entity.Tokens{}, err
+	}
+
+	ok, err := s.hasher.Compare(user.Password, password)
+	if err != nil {
+		return entity.Tokens{}, fmt.Errorf("error to compare password: %w", err)
+	}
+	if !ok {
+		return entity.Tokens{}, ErrUserLogin
+	}
+	if user.BlockedAt != nil {
+		return entity.Tokens{}, ErrUserBlocked
+	}
+
+	if s.hasher.NeedsRehash(user.Password) {
+		s.rehashPassword(ctx, user.Login, password)
+	}
+
+	return s.startSession(ctx, user)
+}
+
+// ChangePassword checks the old password, saves the new one and revokes all sessions of the user.
+// The caller gets a new session instead of the revoked one.
+func (s *authService) ChangePassword(ctx context.Context, login, oldPassword, newPassword string) (entity.Tokens, error) {
+	user, err := s.repo.GetUser(ctx, login)
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+
+	ok, err := s.hasher.Compare(user.Password, oldPassword)
+	if err != nil {
+		return entity.Tokens{}, fmt.Errorf("error to compare password: %w", err)
+	}
+	if !ok {
+		return entity.Tokens{}, ErrWrongPassword
+	}
+
+	if err = s.policy.ValidatePassword("new_password", login, newPassword); err != nil {
+		return entity.Tokens{}, err
+	}
+
+	passwordHash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return entity.Tokens{}, fmt.Errorf("error to hash password: %w", err)
+	}
+
+	if err = s.repo.ChangePassword(ctx, login, passwordHash); err != nil {
+		return entity.Tokens{}, err
+	}
+
+	user, err = s.repo.GetUser(ctx, login)
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+
+	return s.startSession(ctx, user)
+}
+
+// RefreshToken rotates the refresh token: the used one becomes invalid and a new pair is issued.
+// A reused refresh token revokes all sessions started from the same login.
+func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (entity.Tokens, error) {
+	nextRefreshToken, next, err := s.newSession()
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+
+	session, err := s.repo.RotateSession(ctx, hashToken(refreshToken), next)
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+
+	user, err := s.repo.GetUser(ctx, session.UserLogin)
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+	if user.BlockedAt != nil {
+		return entity.Tokens{}, ErrUserBlocked
+	}
+
+	return s.issueTokens(session, nextRefreshToken, user)
+}
+
+// startSession saves a new session family of the user and issues its tokens.
+func (s *authService) startSession(ctx context.Context, user entity.User) (entity.Tokens, error) {
+	refreshToken, session, err := s.newSession()
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+	session.FamilyID, session.UserLogin = session.ID, user.Login
+
+	if err = s.repo.SaveSession(ctx, session); err != nil {
+		return entity.Tokens{}, err
+	}
+
+	return s.issueTokens(session, refreshToken, user)
+}
+
+func (s *authService) newSession() (string, entity.Session, error) {
+	id, err := randomToken(refreshTokenLength)
+	if err != nil {
+		return "", entity.Session{}, err
 	}
-	if user.Password != generatePasswordHash(password) {
-		return "", ErrUserLogin
+
+	refreshToken, err := randomToken(refreshTokenLength)
+	if err != nil {
+		return "", entity.Session{}, err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &tokenClaims{
+	return refreshToken, entity.Session{
+		ID:               id,
+		RefreshTokenHash: hashToken(refreshToken),
+		ExpiresAt:        time.Now().Add(s.refreshTokenTTL),
+	}, nil
+}
+
+func (s *authService) issueTokens(session entity.Session, refreshToken string, user entity.User) (entity.Tokens, error) {
+	tokenID, err := randomToken(refreshTokenLength)
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+
+	accessToken, err := s.keys.Sign(&tokenClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: &jwt.NumericDate{Time: time.Now().Add(tokenTTL)},
+			ID:        tokenID,
+			ExpiresAt: &jwt.NumericDate{Time: time.Now().Add(s.accessTokenTTL)},
 			IssuedAt:  &jwt.NumericDate{Time: time.Now()},
 		},
-		UserLogin: user.Login,
+		UserLogin:  user.Login,
+		Roles:      user.Roles,
+		SessionID:  session.FamilyID,
+		Generation: user.TokenGeneration,
 	})
+	if err != nil {
+		return entity.Tokens{}, fmt.Errorf("error to sign token: %w", err)
+	}
 
-	return token.SignedString([]byte(key))
+	return entity.Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    tokenType,
+		ExpiresIn:    int64(s.accessTokenTTL.Seconds()),
+	}, nil
 }
 
-func (s *authService) ParseToken(accessToken string) (string, error) {
-	token, err := jwt.ParseWithClaims(accessToken, &tokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
-
-		return []byte(key), nil
-	})
+func (s *authService) ParseToken(accessToken string) (entity.Identity, error) {
+	token, err := jwt.ParseWithClaims(accessToken, &tokenClaims{}, s.keys.Keyfunc)
 	if err != nil {
-		return "", err
+		return entity.Identity{}, err
 	}
 
 	claims, ok := token.Claims.(*tokenClaims)
 	if !ok {
-		return "", errors.New("token claims are not of type *tokenClaims")
+		return entity.Identity{}, errors.New("token claims are not of type *tokenClaims")
+	}
+
+	identity := entity.Identity{
+		Login:      claims.UserLogin,
+		Roles:      claims.Roles,
+		TokenID:    claims.ID,
+		SessionID:  claims.SessionID,
+		Generation: claims.Generation,
+	}
+	if claims.ExpiresAt != nil {
+		identity.ExpiresAt = claims.ExpiresAt.Time
+	}
+
+	return identity, nil
+}
+
+// Identify parses the access token and checks it wasn't revoked by a logout and the user isn't blocked.
+func (s *authService) Identify(ctx context.Context, accessToken string) (entity.Identity, error) {
+	identity, err := s.ParseToken(accessToken)
+	if err != nil {
+		return entity.Identity{}, err
+	}
+
+	state, err := s.repo.GetTokenState(ctx, identity.Login, identity.TokenID)
+	if err != nil {
+		return entity.Identity{}, err
+	}
+	if state.Blocked {
+		return entity.Identity{}, ErrUserBlocked
+	}
+	if state.Revoked || identity.Generation != state.Generation {
+		return entity.Identity{}, ErrTokenRevoked
+	}
+
+	return identity, nil
+}
+
+// Logout revokes the access token and the refresh tokens of its session.
+func (s *authService) Logout(ctx context.Context, identity entity.Identity) error {
+	if identity.TokenID != "" {
+		if err := s.repo.RevokeToken(ctx, identity); err != nil {
+			return err
+		}
+	}
+
+	if identity.SessionID != "" {
+		return s.repo.RevokeSessionFamily(ctx, identity.SessionID)
 	}
 
-	return claims.UserLogin, nil
+	return nil
 }
 
-func generatePasswordHash(password string) string {
-	hash := sha1.New()
-	hash.Write([]byte(password))
+// LogoutAll revokes every access and refresh token of the user.
+func (s *authService) LogoutAll(ctx context.Context, login string) error {
+	return s.repo.RevokeUserTokens(ctx, login)
+}
+
+// CleanupExpired removes revoked tokens and sessions that expired anyway.
+func (s *authService) CleanupExpired(ctx context.Context) (int64, error) {
+	return s.repo.DeleteExpiredTokens(ctx)
+}
+
+// rehashPassword upgrades the stored hash to the configured algorithm, a failure doesn't fail the login.
+func (s *authService) rehashPassword(ctx context.Context, login, password string) {
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		s.l.Warn("error to rehash password of %s: %s", login, err.Error())
+		return
+	}
+
+	if err = s.repo.UpdatePassword(ctx, login, passwordHash); err != nil {
+		s.l.Warn("error to save rehashed password of %s: %s", login, err.Error())
+	}
+}
+
+func randomToken(length int) (string, error) {
+	b := make([]byte, length)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error to generate token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
-	return fmt.Sprintf("%x", hash.Sum([]byte(salt)))
+// hashToken is enough for high-entropy random tokens, unlike passwords they don't need a slow hash.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,137 @@
+package usecase
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+)
+
+const (
+	// maxLoginLength is the size of the users.login column.
+	maxLoginLength = 64
+	// maxPasswordLength bounds the work of the password hash, bcrypt ignores bytes after the 72nd anyway.
+	maxPasswordLength = 72
+)
+
+// ValidationError has a message per invalid field of the request.
+type ValidationError struct {
+	Fields map[string]string `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field, message := range e.Fields {
+		fields = append(fields, field+": "+message)
+	}
+	sort.Strings(fields)
+
+	return "invalid " + strings.Join(fields, "; ")
+}
+
+type BreachedPasswords interface {
+	Contains(password string) bool
+}
+
+// CredentialsPolicy validates logins and passwords of new users and new passwords of existing ones.
+type CredentialsPolicy struct {
+	loginMinLength    int
+	loginMaxLength    int
+	loginPattern      *regexp.Regexp
+	passwordMinLength int
+	breached          BreachedPasswords
+}
+
+func NewCredentialsPolicy(
+	loginMinLength, loginMaxLength int,
+	loginPattern string,
+	passwordMinLength int,
+	breached BreachedPasswords,
+) (CredentialsPolicy, error) {
+	if loginMinLength < 1 || loginMaxLength < loginMinLength || loginMaxLength > maxLoginLength {
+		return CredentialsPolicy{}, fmt.Errorf("login length must be between 1 and %d", maxLoginLength)
+	}
+	if passwordMinLength < 1 || passwordMinLength > maxPasswordLength {
+		return CredentialsPolicy{}, fmt.Errorf("password min length must be between 1 and %d", maxPasswordLength)
+	}
+
+	pattern, err := regexp.Compile(loginPattern)
+	if err != nil {
+		return CredentialsPolicy{}, fmt.Errorf("error to compile login pattern: %w", err)
+	}
+
+	return CredentialsPolicy{
+		loginMinLength:    loginMinLength,
+		loginMaxLength:    loginMaxLength,
+		loginPattern:      pattern,
+		passwordMinLength: passwordMinLength,
+		breached:          breached,
+	}, nil
+}
+
+// ValidateUser returns *ValidationError if the login or the password of the new user breaks the policy.
+func (p CredentialsPolicy) ValidateUser(user entity.User) error {
+	fields := make(map[string]string)
+
+	if message := p.validateLogin(user.Login); message != "" {
+		fields["login"] = message
+	}
+	if message := p.validatePassword(user.Login, user.Password); message != "" {
+		fields["password"] = message
+	}
+
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+
+	return nil
+}
+
+// ValidatePassword returns *ValidationError for the field if the new password breaks the policy.
+func (p CredentialsPolicy) ValidatePassword(field, login, password string) error {
+	if message := p.validatePassword(login, password); message != "" {
+		return &ValidationError{Fields: map[string]string{field: message}}
+	}
+
+	return nil
+}
+
+func (p CredentialsPolicy) validateLogin(login string) string {
+	switch length := utf8.RuneCountInString(login); {
+	case login == "":
+		return "login is required"
+	case !utf8.ValidString(login):
+		return "login must be a valid UTF-8 string"
+	case length < p.loginMinLength || length > p.loginMaxLength:
+		return fmt.Sprintf("login must be from %d to %d characters", p.loginMinLength, p.loginMaxLength)
+	case !p.loginPattern.MatchString(login):
+		return fmt.Sprintf("login must match %s", p.loginPattern.String())
+	}
+
+	return ""
+}
+
+func (p CredentialsPolicy) validatePassword(login, password string) string {
+	switch {
+	case password == "":
+		return "password is required"
+	case !utf8.ValidString(password):
+		return "password must be a valid UTF-8 string"
+	case strings.IndexFunc(password, unicode.IsControl) >= 0:
+		return "password mustn't contain control characters"
+	case utf8.RuneCountInString(password) < p.passwordMinLength:
+		return fmt.Sprintf("password must be at least %d characters", p.passwordMinLength)
+	case len(password) > maxPasswordLength:
+		return fmt.Sprintf("password must be at most %d bytes", maxPasswordLength)
+	case strings.EqualFold(password, login):
+		return "password mustn't be the same as login"
+	case p.breached != nil && p.breached.Contains(password):
+		return "password is too common, it's found in leaked passwords"
+	}
+
+	return ""
+}
@@ -0,0 +1,135 @@
+package usecase
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+	"github.com/IgorAleksandroff/gophermart/pkg/breached"
+)
+
+func newTestCredentialsPolicy(t *testing.T) CredentialsPolicy {
+	t.Helper()
+
+	policy, err := NewCredentialsPolicy(3, 16, `^[a-zA-Z0-9._-]+$`, 8, breached.Bundled())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return policy
+}
+
+func TestCredentialsPolicyValidateUser(t *testing.T) {
+	policy := newTestCredentialsPolicy(t)
+
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		// wantFields maps the invalid fields to a part of their message
+		wantFields map[string]string
+	}{
+		{name: "valid", login: "alice", password: "correct horse"},
+		{name: "valid at the limits", login: "abc", password: strings.Repeat("x", 72)},
+		{name: "empty login", login: "", password: "correct horse",
+			wantFields: map[string]string{"login": "required"}},
+		{name: "too short login", login: "ab", password: "correct horse",
+			wantFields: map[string]string{"login": "from 3 to 16 characters"}},
+		{name: "too long login", login: strings.Repeat("a", 17), password: "correct horse",
+			wantFields: map[string]string{"login": "from 3 to 16 characters"}},
+		{name: "login pattern mismatch", login: "alice smith", password: "correct horse",
+			wantFields: map[string]string{"login": "must match"}},
+		{name: "non-ASCII login", login: "алиса", password: "correct horse",
+			wantFields: map[string]string{"login": "must match"}},
+		{name: "invalid UTF-8 login", login: "ali\xffce", password: "correct horse",
+			wantFields: map[string]string{"login": "UTF-8"}},
+		{name: "empty password", login: "alice", password: "",
+			wantFields: map[string]string{"password": "required"}},
+		{name: "too short password", login: "alice", password: "short",
+			wantFields: map[string]string{"password": "at least 8 characters"}},
+		{name: "control character", login: "alice", password: "correct\x00horse",
+			wantFields: map[string]string{"password": "control characters"}},
+		{name: "newline", login: "alice", password: "correct\nhorse",
+			wantFields: map[string]string{"password": "control characters"}},
+		{name: "over 72 bytes", login: "alice", password: strings.Repeat("x", 73),
+			wantFields: map[string]string{"password": "at most 72 bytes"}},
+		{name: "over 72 bytes in fewer characters", login: "alice", password: strings.Repeat("ё", 40),
+			wantFields: map[string]string{"password": "at most 72 bytes"}},
+		{name: "same as login", login: "alice.smith", password: "Alice.Smith",
+			wantFields: map[string]string{"password": "same as login"}},
+		{name: "breached", login: "alice", password: "password",
+			wantFields: map[string]string{"password": "leaked"}},
+		{name: "breached in another case", login: "alice", password: "QWERTYUIOP",
+			wantFields: map[string]string{"password": "leaked"}},
+		{name: "both fields", login: "", password: "",
+			wantFields: map[string]string{"login": "required", "password": "required"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.ValidateUser(entity.User{Login: tt.login, Password: tt.password})
+			assertValidationFields(t, err, tt.wantFields)
+		})
+	}
+}
+
+func TestCredentialsPolicyValidatePassword(t *testing.T) {
+	policy := newTestCredentialsPolicy(t)
+
+	assertValidationFields(t, policy.ValidatePassword("new_password", "alice", "correct horse"), nil)
+	assertValidationFields(t, policy.ValidatePassword("new_password", "alice", "ALICE"),
+		map[string]string{"new_password": "at least 8 characters"})
+	assertValidationFields(t, policy.ValidatePassword("new_password", "alice", "123456789"),
+		map[string]string{"new_password": "leaked"})
+}
+
+func TestNewCredentialsPolicy(t *testing.T) {
+	tests := []struct {
+		name              string
+		loginMin          int
+		loginMax          int
+		pattern           string
+		passwordMinLength int
+	}{
+		{name: "zero login min length", loginMin: 0, loginMax: 16, pattern: ".*", passwordMinLength: 8},
+		{name: "login max under min", loginMin: 5, loginMax: 4, pattern: ".*", passwordMinLength: 8},
+		{name: "login max over the column", loginMin: 3, loginMax: maxLoginLength + 1, pattern: ".*", passwordMinLength: 8},
+		{name: "zero password min length", loginMin: 3, loginMax: 16, pattern: ".*", passwordMinLength: 0},
+		{name: "password min over 72", loginMin: 3, loginMax: 16, pattern: ".*", passwordMinLength: maxPasswordLength + 1},
+		{name: "invalid pattern", loginMin: 3, loginMax: 16, pattern: "[", passwordMinLength: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewCredentialsPolicy(tt.loginMin, tt.loginMax, tt.pattern, tt.passwordMinLength, nil)
+			if err == nil {
+				t.Error("NewCredentialsPolicy returned no error")
+			}
+		})
+	}
+}
+
+func assertValidationFields(t *testing.T, err error, wantFields map[string]string) {
+	t.Helper()
+
+	if len(wantFields) == 0 {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("error = %v, want *ValidationError", err)
+	}
+	if len(validationErr.Fields) != len(wantFields) {
+		t.Errorf("invalid fields = %v, want %v", validationErr.Fields, wantFields)
+	}
+	for field, want := range wantFields {
+		if message, ok := validationErr.Fields[field]; !ok || !strings.Contains(message, want) {
+			t.Errorf("field %s message = %q, want it to contain %q", field, message, want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package usecase
+
+import (
+	"context"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+)
+
+// LedgerAudit checks that the balance counters of users match their ledger entries. The counters are updated
+// in the same transactions as the ledger, so any drift means a bug or a manual change of the database.
+type LedgerAudit interface {
+	Reconcile(ctx context.Context) ([]entity.BalanceDrift, error)
+}
+
+type LedgerAuditRepository interface {
+	ReconcileBalances(ctx context.Context) ([]entity.BalanceDrift, error)
+}
+
+type ledgerAudit struct {
+	repo LedgerAuditRepository
+}
+
+func NewLedgerAudit(repo LedgerAuditRepository) *ledgerAudit {
+	return &ledgerAudit{repo: repo}
+}
+
+// Reconcile returns the users whose current balance differs from the sum of their ledger entries
+// or whose withdrawn total differs from the sum of their withdrawals.
+func (a *ledgerAudit) Reconcile(ctx context.Context) ([]entity.BalanceDrift, error) {
+	return a.repo.ReconcileBalances(ctx)
+}
@@ -0,0 +1,151 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+//go:generate mockery --name LoginGuard
+
+// maxLockout caps the progressive lockout, so a locked out user can log in again the same day.
+const maxLockout = time.Hour
+
+// LoginLockedError is returned when the login or the client IP is locked out after too many failed logins.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+type loginGuard struct {
+	repo        LoginAttemptsRepository
+	loginLimits LoginLimits
+	ipLimits    LoginLimits
+}
+
+// LoginGuard tracks login attempts by login and by client IP. After maxAttempts failures in a row the key
+// is locked out for lockout, every next failure doubles it.
+type LoginGuard interface {
+	Attempt(ctx context.Context, login, ip string) error
+	Succeeded(ctx context.Context, login, ip string) error
+}
+
+type LoginAttemptsRepository interface {
+	AddLoginAttempt(ctx context.Context, key string, limits LoginLimits) (time.Time, error)
+	ReleaseLoginAttempt(ctx context.Context, key string, limits LoginLimits) error
+	ResetLoginFailures(ctx context.Context, key string) error
+}
+
+// LoginLimits are the lockout rules of a key.
+type LoginLimits struct {
+	// MaxAttempts failures in a row lock the key out, zero turns the lockout off.
+	MaxAttempts int
+	// Window starts the count over if the previous attempt was longer ago.
+	Window time.Duration
+	// Lockout is the first lockout, every next failure over MaxAttempts doubles it up to MaxLockout.
+	Lockout    time.Duration
+	MaxLockout time.Duration
+}
+
+// LockoutFor returns how long the key is locked out after the failures in a row, zero under the threshold.
+func (l LoginLimits) LockoutFor(failures int) time.Duration {
+	if l.MaxAttempts <= 0 || failures < l.MaxAttempts {
+		return 0
+	}
+
+	lockout := l.Lockout
+	for i := 0; i < failures-l.MaxAttempts && lockout < l.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > l.MaxLockout {
+		return l.MaxLockout
+	}
+
+	return lockout
+}
+
+func NewLoginGuard(
+	repo LoginAttemptsRepository,
+	maxAttempts, maxIPAttempts int,
+	lockout, failuresWindow time.Duration,
+) *loginGuard {
+	return &loginGuard{
+		repo: repo,
+		loginLimits: LoginLimits{
+			MaxAttempts: maxAttempts,
+			Window:      failuresWindow,
+			Lockout:     lockout,
+			MaxLockout:  maxLockout,
+		},
+		ipLimits: LoginLimits{
+			MaxAttempts: maxIPAttempts,
+			Window:      failuresWindow,
+			Lockout:     lockout,
+			MaxLockout:  maxLockout,
+		},
+	}
+}
+
+// Attempt counts the login attempt as a failure in advance, in one atomic step with the lockout check,
+// so concurrent guesses can't get over the threshold before their failures are counted. It returns
+// *LoginLockedError if the login or the IP is locked out, then the attempt isn't counted.
+func (g *loginGuard) Attempt(ctx context.Context, login, ip string) error {
+	lockedUntil, err := g.repo.AddLoginAttempt(ctx, loginKey(login), g.loginLimits)
+	if err != nil {
+		return err
+	}
+	if !lockedUntil.IsZero() {
+		return lockedError(lockedUntil)
+	}
+
+	lockedUntil, err = g.repo.AddLoginAttempt(ctx, ipKey(ip), g.ipLimits)
+	if err != nil {
+		return err
+	}
+	if !lockedUntil.IsZero() {
+		if err = g.repo.ReleaseLoginAttempt(ctx, loginKey(login), g.loginLimits); err != nil {
+			return err
+		}
+		return lockedError(lockedUntil)
+	}
+
+	return nil
+}
+
+// Succeeded resets the failures of the login and takes back the attempt counted for the IP in advance.
+// The other IP failures aren't reset: one valid account mustn't let guess passwords of the others.
+func (g *loginGuard) Succeeded(ctx context.Context, login, ip string) error {
+	if err := g.repo.ResetLoginFailures(ctx, loginKey(login)); err != nil {
+		return err
+	}
+
+	return g.repo.ReleaseLoginAttempt(ctx, ipKey(ip), g.ipLimits)
+}
+
+// lockedError reports the lockout, at least a second of it: the lock may just have ended after the attempt
+// was refused, and the refused attempt wasn't counted.
+func lockedError(lockedUntil time.Time) *LoginLockedError {
+	retryAfter := time.Until(lockedUntil)
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+
+	return &LoginLockedError{RetryAfter: retryAfter}
+}
+
+// loginKey hashes the login, so the key fits the login_attempts column whatever login is tried:
+// logins aren't validated on login, only on registration.
+func loginKey(login string) string {
+	sum := sha256.Sum256([]byte(login))
+
+	return "login:" + hex.EncodeToString(sum[:])
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
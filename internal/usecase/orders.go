@@ -2,9 +2,9 @@ package usecase
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/IgorAleksandroff/gophermart/internal/entity"
 )
@@ -12,43 +12,49 @@ import (
 //go:generate mockery --name Orders
 //go:generate mockery --name OrdersRepository
 
-const accrualEndpoint = "/api/orders/"
-const accrualStatusNoContent = "PROCESSING"
+const accrualStatusRegistered = "REGISTERED"
 
 var ErrExistOrderByThisUser = errors.New("order number already uploaded by this user")
 var ErrExistOrderByAnotherUser = errors.New("order number already uploaded by another user")
 var ErrLowBalance = errors.New("low balance of current user")
+var ErrWithdrawalExists = errors.New("withdrawal with the order number already exists")
+var ErrUnknownOrder = errors.New("unknown order")
 
 type ordersUsecase struct {
 	repo          OrdersRepository
-	accrualClient apiClient
+	accrualClient AccrualClient
 }
 
 type Orders interface {
 	GetUser(ctx context.Context, login string) (entity.User, error)
-	SaveOrder(ctx context.Context, order entity.Order) error
-	GetOrders(ctx context.Context, login string) ([]entity.Orders, error)
+	RegisterOrder(ctx context.Context, order entity.Order) error
+	RegisterOrders(ctx context.Context, login, apiKeyID string, numbers []string) ([]entity.OrderUploadResult, error)
+	GetOrders(ctx context.Context, login string, filter entity.ListFilter) ([]entity.Orders, string, error)
+	GetOrderDetails(ctx context.Context, login, orderID string) (entity.OrderDetails, error)
 	SaveWithdrawn(ctx context.Context, order entity.OrderWithdraw) error
-	GetWithdrawals(ctx context.Context, login string) ([]entity.OrderWithdraw, error)
+	GetWithdrawals(ctx context.Context, login string, filter entity.ListFilter) ([]entity.OrderWithdraw, string, error)
+	GetLedger(ctx context.Context, login string, limit, offset int) ([]entity.LedgerEntry, error)
 }
 
 type OrdersRepository interface {
 	GetUser(ctx context.Context, login string) (entity.User, error)
+	CreateOrder(ctx context.Context, order entity.Order) (bool, error)
+	CreateOrders(ctx context.Context, orders []entity.Order) (map[string]string, error)
 	SaveOrder(ctx context.Context, order entity.Order) error
 	GetOrder(ctx context.Context, orderID string) (*entity.Order, error)
-	GetOrders(ctx context.Context, login string) ([]entity.Orders, error)
-	UpdateUser(ctx context.Context, user entity.User) error
-	SupplementBalance(ctx context.Context, order entity.Order) error
-	SaveWithdrawn(ctx context.Context, order entity.OrderWithdraw) error
-	GetWithdrawals(ctx context.Context, login string) ([]entity.OrderWithdraw, error)
+	GetOrders(ctx context.Context, login string, filter entity.ListFilter) ([]entity.Orders, error)
+	GetOrderHistory(ctx context.Context, orderID string) ([]entity.OrderStatusChange, error)
+	Withdraw(ctx context.Context, order entity.OrderWithdraw) error
+	GetWithdrawals(ctx context.Context, login string, filter entity.ListFilter) ([]entity.OrderWithdraw, error)
+	GetLedger(ctx context.Context, login string, limit, offset int) ([]entity.LedgerEntry, error)
 	Close()
 }
 
-type apiClient interface {
-	DoGet(url string) ([]byte, error)
+type AccrualClient interface {
+	GetAccrual(ctx context.Context, orderID string) (entity.Accrual, error)
 }
 
-func NewOrders(r OrdersRepository, c apiClient) *ordersUsecase {
+func NewOrders(r OrdersRepository, c AccrualClient) *ordersUsecase {
 	return &ordersUsecase{repo: r, accrualClient: c}
 }
 
@@ -56,78 +62,199 @@ func (o *ordersUsecase) GetUser(ctx context.Context, login string) (entity.User,
 	return o.repo.GetUser(ctx, login)
 }
 
-func (o *ordersUsecase) SaveOrder(ctx context.Context, order entity.Order) error {
-	var accrual entity.Accrual
-	out, err := o.accrualClient.DoGet(accrualEndpoint + order.OrderID)
+// RegisterOrder saves a new order with the NEW status, the accrual is requested later by the worker.
+func (o *ordersUsecase) RegisterOrder(ctx context.Context, order entity.Order) error {
+	order.Status = entity.StatusNew
+
+	created, err := o.repo.CreateOrder(ctx, order)
 	if err != nil {
-		return fmt.Errorf("error with order %v from service accurual: %w", order.OrderID, err)
+		return err
+	}
+	if created {
+		return nil
 	}
 
-	err = json.Unmarshal(out, &accrual)
-	if err != nil && len(out) != 0 {
-		return fmt.Errorf("error with order %v parse answer from service accurual: %w", order.OrderID, err)
+	existedOrder, err := o.repo.GetOrder(ctx, order.OrderID)
+	if err != nil {
+		return err
+	}
+	if existedOrder.UserLogin != order.UserLogin {
+		return ErrExistOrderByAnotherUser
 	}
 
-	if len(out) == 0 {
-		accrual.Status = accrualStatusNoContent
+	return ErrExistOrderByThisUser
+}
+
+// RegisterOrders saves the valid new orders of a batch with the NEW status in one transaction
+// and returns the result of every number in the batch order.
+func (o *ordersUsecase) RegisterOrders(
+	ctx context.Context,
+	login, apiKeyID string,
+	numbers []string,
+) ([]entity.OrderUploadResult, error) {
+	results := make([]entity.OrderUploadResult, len(numbers))
+	orders := make([]entity.Order, 0, len(numbers))
+	seen := make(map[string]bool, len(numbers))
+	for i, number := range numbers {
+		results[i] = entity.OrderUploadResult{Number: number, Result: entity.UploadAccepted}
+
+		number, err := entity.NormalizeOrderNumber(number)
+		if errors.Is(err, entity.ErrOrderNumberTooLong) {
+			results[i].Result = entity.UploadTooLong
+			continue
+		}
+		if err != nil {
+			results[i].Result = entity.UploadInvalid
+			continue
+		}
+		results[i].Number = number
+		if seen[number] {
+			continue
+		}
+		seen[number] = true
+
+		orders = append(orders, entity.Order{
+			OrderID:   number,
+			UserLogin: login,
+			Status:    entity.StatusNew,
+			APIKeyID:  apiKeyID,
+		})
 	}
 
-	order.Status = accrual.Status
-	if accrual.Accrual != nil {
-		order.Accrual = *accrual.Accrual
+	if len(orders) == 0 {
+		return results, nil
 	}
 
-	var existError error
-	existedOrder, err := o.repo.GetOrder(ctx, order.OrderID)
-	if existedOrder != nil && err == nil {
-		if existedOrder.UserLogin != order.UserLogin {
-			return ErrExistOrderByAnotherUser
+	owners, err := o.repo.CreateOrders(ctx, orders)
+	if err != nil {
+		return nil, err
+	}
+
+	created := make(map[string]bool, len(orders))
+	for i, result := range results {
+		if result.Result != entity.UploadAccepted {
+			continue
 		}
 
-		existError = ErrExistOrderByThisUser
+		owner, existed := owners[result.Number]
+		switch {
+		case existed && owner != login:
+			results[i].Result = entity.UploadConflict
+		case existed || created[result.Number]:
+			results[i].Result = entity.UploadAlreadyUploaded
+		default:
+			created[result.Number] = true
+		}
 	}
 
-	err = o.repo.SaveOrder(ctx, order)
+	return results, nil
+}
+
+// SaveOrder requests the accrual of the registered order and saves its new status.
+func (o *ordersUsecase) SaveOrder(ctx context.Context, order entity.Order) error {
+	accrual, err := o.accrualClient.GetAccrual(ctx, order.OrderID)
 	if err != nil {
-		return err
+		return fmt.Errorf("error with order %v from service accurual: %w", order.OrderID, err)
 	}
 
-	err = o.repo.SupplementBalance(ctx, order)
-	if err != nil {
-		return err
+	if accrual.Status == accrualStatusRegistered {
+		accrual.Status = entity.StatusProcessing
 	}
 
-	return existError
+	order.Status = accrual.Status
+	if accrual.Accrual != nil {
+		order.Accrual = *accrual.Accrual
+	}
+
+	return o.repo.SaveOrder(ctx, order)
 }
 
-func (o *ordersUsecase) GetOrders(ctx context.Context, login string) ([]entity.Orders, error) {
-	return o.repo.GetOrders(ctx, login)
+// GetOrders returns a page of the user orders, oldest first, and the cursor of the next page, empty on the last one.
+// Without a limit the whole list is one page.
+func (o *ordersUsecase) GetOrders(
+	ctx context.Context,
+	login string,
+	filter entity.ListFilter,
+) ([]entity.Orders, string, error) {
+	if filter.Limit > 0 {
+		filter.Limit++
+	}
+	orders, err := o.repo.GetOrders(ctx, login, filter)
+	if err != nil || filter.Limit == 0 || len(orders) < filter.Limit {
+		return orders, "", err
+	}
+
+	orders = orders[:filter.Limit-1]
+	last := orders[len(orders)-1]
+	next, err := nextCursor(last.UploadedAt, last.OrderID)
+
+	return orders, next, err
 }
 
 func (o *ordersUsecase) SaveWithdrawn(ctx context.Context, withdrawn entity.OrderWithdraw) error {
-	user, err := o.repo.GetUser(ctx, withdrawn.UserLogin)
+	return o.repo.Withdraw(ctx, withdrawn)
+}
+
+// GetOrderDetails returns the user order with its status timeline. An order of another user
+// is reported as ErrUnknownOrder too, so order numbers of other users aren't disclosed.
+func (o *ordersUsecase) GetOrderDetails(ctx context.Context, login, orderID string) (entity.OrderDetails, error) {
+	order, err := o.repo.GetOrder(ctx, orderID)
 	if err != nil {
-		return err
+		return entity.OrderDetails{}, err
 	}
-
-	if withdrawn.Value > user.Current {
-		return ErrLowBalance
+	if order.UserLogin != login {
+		return entity.OrderDetails{}, ErrUnknownOrder
 	}
-	user.Current = user.Current - withdrawn.Value
-	user.Withdrawn = user.Withdrawn + withdrawn.Value
 
-	err = o.repo.UpdateUser(ctx, user)
+	history, err := o.repo.GetOrderHistory(ctx, orderID)
 	if err != nil {
-		return err
+		return entity.OrderDetails{}, err
+	}
+	if history == nil {
+		history = []entity.OrderStatusChange{}
 	}
 
-	if err = o.repo.SaveWithdrawn(ctx, withdrawn); err != nil {
-		return err
+	return entity.OrderDetails{
+		Orders: entity.Orders{
+			OrderID:    order.OrderID,
+			Status:     order.Status,
+			Accrual:    order.Accrual,
+			UploadedAt: order.UploadedAt,
+		},
+		History: history,
+	}, nil
+}
+
+// GetWithdrawals returns a page of the user withdrawals like GetOrders, sorted by the processing time.
+func (o *ordersUsecase) GetWithdrawals(
+	ctx context.Context,
+	login string,
+	filter entity.ListFilter,
+) ([]entity.OrderWithdraw, string, error) {
+	if filter.Limit > 0 {
+		filter.Limit++
 	}
+	withdrawals, err := o.repo.GetWithdrawals(ctx, login, filter)
+	if err != nil || filter.Limit == 0 || len(withdrawals) < filter.Limit {
+		return withdrawals, "", err
+	}
+
+	withdrawals = withdrawals[:filter.Limit-1]
+	last := withdrawals[len(withdrawals)-1]
+	next, err := nextCursor(last.ProcessedAt, last.OrderID)
+
+	return withdrawals, next, err
+}
 
-	return nil
+func (o *ordersUsecase) GetLedger(ctx context.Context, login string, limit, offset int) ([]entity.LedgerEntry, error) {
+	return o.repo.GetLedger(ctx, login, limit, offset)
 }
 
-func (o *ordersUsecase) GetWithdrawals(ctx context.Context, login string) ([]entity.OrderWithdraw, error) {
-	return o.repo.GetWithdrawals(ctx, login)
+func nextCursor(at, orderID string) (string, error) {
+	t, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		return "", fmt.Errorf("error to parse time of the page cursor: %w, %s", err, orderID)
+	}
+
+	return entity.Cursor{Time: t, OrderID: orderID}.String(), nil
 }
@@ -0,0 +1,102 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+)
+
+//go:generate mockery --name PasswordReset
+
+const resetTokenLength = 32
+
+var ErrInvalidResetToken = errors.New("invalid, used or expired password reset token")
+
+type passwordResetService struct {
+	repo     PasswordResetRepository
+	hasher   PasswordHasher
+	policy   CredentialsPolicy
+	notifier Notifier
+	ttl      time.Duration
+}
+
+// PasswordReset is the reset flow for users who lost the password: an operator requests a reset,
+// the user gets a single-use token through the notifier and sets a new password with it.
+type PasswordReset interface {
+	RequestReset(ctx context.Context, login string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+}
+
+type PasswordResetRepository interface {
+	SavePasswordReset(ctx context.Context, reset entity.PasswordReset) error
+	GetPasswordReset(ctx context.Context, tokenHash string) (entity.PasswordReset, error)
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) (string, error)
+}
+
+// Notifier delivers messages to users, e.g. by email.
+type Notifier interface {
+	NotifyPasswordReset(ctx context.Context, login, token string, expiresAt time.Time) error
+}
+
+func NewPasswordReset(
+	repo PasswordResetRepository,
+	hasher PasswordHasher,
+	policy CredentialsPolicy,
+	notifier Notifier,
+	ttl time.Duration,
+) *passwordResetService {
+	return &passwordResetService{
+		repo:     repo,
+		hasher:   hasher,
+		policy:   policy,
+		notifier: notifier,
+		ttl:      ttl,
+	}
+}
+
+// RequestReset saves a new reset token of the user and sends it through the notifier.
+func (s *passwordResetService) RequestReset(ctx context.Context, login string) error {
+	token, err := randomToken(resetTokenLength)
+	if err != nil {
+		return err
+	}
+
+	reset := entity.PasswordReset{
+		TokenHash: hashToken(token),
+		UserLogin: login,
+		ExpiresAt: time.Now().Add(s.ttl),
+	}
+	if err = s.repo.SavePasswordReset(ctx, reset); err != nil {
+		return err
+	}
+
+	if err = s.notifier.NotifyPasswordReset(ctx, login, token, reset.ExpiresAt); err != nil {
+		return fmt.Errorf("error to notify password reset: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword sets the new password by the reset token and revokes all sessions of the user.
+func (s *passwordResetService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	reset, err := s.repo.GetPasswordReset(ctx, hashToken(token))
+	if err != nil {
+		return err
+	}
+
+	if err = s.policy.ValidatePassword("new_password", reset.UserLogin, newPassword); err != nil {
+		return err
+	}
+
+	passwordHash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return fmt.Errorf("error to hash password: %w", err)
+	}
+
+	_, err = s.repo.ResetPassword(ctx, hashToken(token), passwordHash)
+
+	return err
+}
@@ -2,20 +2,33 @@ package usecase
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/IgorAleksandroff/gophermart/internal/entity"
+	"github.com/IgorAleksandroff/gophermart/internal/webapi"
 )
 
 //go:generate mockery --name UpdaterStatuses
 
+const (
+	retryBaseDelay = time.Second
+	retryMaxDelay  = time.Hour
+	// notRegisteredDelay is how soon an order the accrual system doesn't know yet is polled again.
+	notRegisteredDelay = 10 * time.Second
+)
+
 type statusesUsecase struct {
-	orders UpdaterOrders
-	repo   StatusesRepository
+	orders      UpdaterOrders
+	repo        StatusesRepository
+	maxAttempts int
 }
 
 type UpdaterStatuses interface {
-	UpdateStatus(ctx context.Context) error
+	GetOrdersForUpdate(ctx context.Context, limit int) ([]entity.Order, error)
+	UpdateStatus(ctx context.Context, order entity.Order) error
+	Postpone(ctx context.Context, order entity.Order, until time.Time, reason string) error
 }
 
 type UpdaterOrders interface {
@@ -23,22 +36,97 @@ type UpdaterOrders interface {
 }
 
 type StatusesRepository interface {
-	GetOrderForUpdate(ctx context.Context) (*entity.Order, error)
+	GetOrdersForUpdate(ctx context.Context, limit int) ([]entity.Order, error)
+	RetryOrder(ctx context.Context, retry entity.OrderRetry) error
 }
 
-func NewStatuses(o UpdaterOrders, r StatusesRepository) *statusesUsecase {
-	return &statusesUsecase{orders: o, repo: r}
+func NewStatuses(o UpdaterOrders, r StatusesRepository, maxAttempts int) *statusesUsecase {
+	return &statusesUsecase{orders: o, repo: r, maxAttempts: maxAttempts}
 }
 
-func (s *statusesUsecase) UpdateStatus(ctx context.Context) error {
-	order, err := s.repo.GetOrderForUpdate(ctx)
+func (s *statusesUsecase) GetOrdersForUpdate(ctx context.Context, limit int) ([]entity.Order, error) {
+	orders, err := s.repo.GetOrdersForUpdate(ctx, limit)
 	if err != nil {
-		return fmt.Errorf("error to get order for update: %w", err)
+		return nil, fmt.Errorf("error to get orders for update: %w", err)
+	}
+
+	return orders, nil
+}
+
+// UpdateStatus polls the order and on failure schedules the next poll with exponential backoff.
+// After maxAttempts failed polls in a row the order is moved to the dead letter. An order not registered
+// in the accrual system yet isn't a failure, it's polled again later without counting an attempt.
+func (s *statusesUsecase) UpdateStatus(ctx context.Context, order entity.Order) error {
+	err := s.orders.SaveOrder(ctx, order)
+	if err == nil {
+		return nil
+	}
+
+	// the rate limit is a pause of the whole service, not a failure of the order
+	var rateLimitErr *webapi.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return err
+	}
+
+	if errors.Is(err, webapi.ErrOrderNotRegistered) {
+		retry := entity.OrderRetry{
+			OrderID:    order.OrderID,
+			Attempts:   order.PollAttempts,
+			NextPollAt: time.Now().Add(notRegisteredDelay),
+			LastError:  err.Error(),
+		}
+		if retryErr := s.repo.RetryOrder(ctx, retry); retryErr != nil {
+			return fmt.Errorf("%v; error to schedule poll: %w", err, retryErr)
+		}
+
+		return nil
+	}
+
+	retry := entity.OrderRetry{
+		OrderID:    order.OrderID,
+		Attempts:   order.PollAttempts + 1,
+		NextPollAt: time.Now().Add(retryDelay(order.PollAttempts + 1)),
+		LastError:  err.Error(),
 	}
+	if s.maxAttempts > 0 && retry.Attempts >= s.maxAttempts {
+		retry.DeadLetter = true
+	}
+
+	if retryErr := s.repo.RetryOrder(ctx, retry); retryErr != nil {
+		return fmt.Errorf("%v; error to schedule retry: %w", err, retryErr)
+	}
+
+	if retry.DeadLetter {
+		return fmt.Errorf("order %s moved to dead letter after %d attempts: %w", order.OrderID, retry.Attempts, err)
+	}
+
+	return err
+}
+
+// Postpone releases the claimed order until the time without counting a poll attempt, so a poller
+// pausing on the accrual rate limit doesn't keep the order claimed past the lease.
+func (s *statusesUsecase) Postpone(ctx context.Context, order entity.Order, until time.Time, reason string) error {
+	retry := entity.OrderRetry{
+		OrderID:    order.OrderID,
+		Attempts:   order.PollAttempts,
+		NextPollAt: until,
+		LastError:  reason,
+	}
+	if err := s.repo.RetryOrder(ctx, retry); err != nil {
+		return fmt.Errorf("error to postpone poll: %w", err)
+	}
+
+	return nil
+}
 
-	if order == nil {
-		return fmt.Errorf("get empty order for update")
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMaxDelay {
+			return retryMaxDelay
+		}
 	}
 
-	return s.orders.SaveOrder(ctx, *order)
+	return delay
 }
@@ -0,0 +1,128 @@
+package webapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+)
+
+//go:generate mockery --name "AccrualClient"
+
+const (
+	accrualEndpoint = "/api/orders/"
+
+	// defaultRetryAfter is used when the accrual system answers 429 without a valid Retry-After header.
+	defaultRetryAfter = time.Minute
+)
+
+var (
+	ErrOrderNotRegistered = errors.New("order is not registered in the accrual system")
+	ErrAccrualUnavailable = errors.New("accrual system is unavailable")
+
+	requestsLimitRegexp = regexp.MustCompile(`\d+`)
+)
+
+// RateLimitError is returned when the accrual system answers 429 Too Many Requests.
+type RateLimitError struct {
+	RetryAfter        time.Duration
+	RequestsPerMinute int
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("accrual system rate limit exceeded (%d requests per minute), retry after %s",
+		e.RequestsPerMinute, e.RetryAfter)
+}
+
+type (
+	accrualClient struct {
+		serverName string
+		transport  *http.Client
+	}
+
+	AccrualClient interface {
+		GetAccrual(ctx context.Context, orderID string) (entity.Accrual, error)
+	}
+)
+
+func NewAccrualClient(serverName string) AccrualClient {
+	return &accrualClient{
+		serverName: serverName,
+		transport:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// GetAccrual requests the order accrual. Besides transport errors it returns
+// ErrOrderNotRegistered for 204, *RateLimitError for 429 and ErrAccrualUnavailable for 5xx answers.
+func (c accrualClient) GetAccrual(ctx context.Context, orderID string) (entity.Accrual, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.serverName+accrualEndpoint+orderID, nil)
+	if err != nil {
+		return entity.Accrual{}, err
+	}
+
+	r, err := c.transport.Do(req)
+	if err != nil {
+		return entity.Accrual{}, fmt.Errorf("%w: %s", ErrAccrualUnavailable, err.Error())
+	}
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return entity.Accrual{}, fmt.Errorf("error to read accrual answer for order %s: %w", orderID, err)
+	}
+
+	switch {
+	case r.StatusCode == http.StatusOK:
+		var accrual entity.Accrual
+		if err = json.Unmarshal(body, &accrual); err != nil {
+			return entity.Accrual{}, fmt.Errorf("error to parse accrual answer for order %s: %w", orderID, err)
+		}
+		return accrual, nil
+	case r.StatusCode == http.StatusNoContent:
+		return entity.Accrual{}, ErrOrderNotRegistered
+	case r.StatusCode == http.StatusTooManyRequests:
+		return entity.Accrual{}, &RateLimitError{
+			RetryAfter:        parseRetryAfter(r.Header.Get("Retry-After")),
+			RequestsPerMinute: parseRequestsLimit(string(body)),
+		}
+	case r.StatusCode >= http.StatusInternalServerError:
+		return entity.Accrual{}, fmt.Errorf("%w: status code %d", ErrAccrualUnavailable, r.StatusCode)
+	}
+
+	return entity.Accrual{}, fmt.Errorf("unexpected accrual status code %d for order %s", r.StatusCode, orderID)
+}
+
+// parseRetryAfter supports both forms of the header: delay in seconds and HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay
+		}
+		return 0
+	}
+
+	return defaultRetryAfter
+}
+
+// parseRequestsLimit reads N from the body "No more than N requests per minute allowed", 0 if it's absent.
+func parseRequestsLimit(body string) int {
+	limit, err := strconv.Atoi(requestsLimitRegexp.FindString(body))
+	if err != nil {
+		return 0
+	}
+
+	return limit
+}
+
+var _ AccrualClient = &accrualClient{}
@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/IgorAleksandroff/gophermart/pkg/logger"
+)
+
+const cleanPeriod = time.Hour
+
+type expiredCleaner interface {
+	CleanupExpired(ctx context.Context) (int64, error)
+}
+
+// Cleaner periodically removes revoked tokens and sessions which are expired anyway.
+type Cleaner struct {
+	period  time.Duration
+	cleaner expiredCleaner
+	l       *logger.Logger
+}
+
+func NewCleaner(cleaner expiredCleaner, l *logger.Logger) *Cleaner {
+	return &Cleaner{
+		period:  cleanPeriod,
+		cleaner: cleaner,
+		l:       l,
+	}
+}
+
+// Run cleans up once per period until ctx is cancelled.
+func (c *Cleaner) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		deleted, err := c.cleaner.CleanupExpired(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				c.l.Warn("can't clean up expired tokens, %s", err.Error())
+			}
+			continue
+		}
+		if deleted > 0 {
+			c.l.Info("cleaned up %d expired tokens", deleted)
+		}
+	}
+}
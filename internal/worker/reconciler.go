@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
+	"github.com/IgorAleksandroff/gophermart/pkg/logger"
+)
+
+const reconcilePeriod = time.Hour
+
+type balanceReconciler interface {
+	Reconcile(ctx context.Context) ([]entity.BalanceDrift, error)
+}
+
+// Reconciler periodically compares the balance counters with the ledger and reports every drift as an error.
+type Reconciler struct {
+	period     time.Duration
+	reconciler balanceReconciler
+	l          *logger.Logger
+}
+
+func NewReconciler(reconciler balanceReconciler, l *logger.Logger) *Reconciler {
+	return &Reconciler{
+		period:     reconcilePeriod,
+		reconciler: reconciler,
+		l:          l,
+	}
+}
+
+// Run reconciles once per period until ctx is cancelled.
+func (r *Reconciler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		drifts, err := r.reconciler.Reconcile(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.l.Warn("can't reconcile balances with the ledger, %s", err.Error())
+			}
+			continue
+		}
+
+		for _, d := range drifts {
+			r.l.Error("balance of %s drifted from the ledger: current %s, ledger %s, withdrawn %s, ledger withdrawn %s",
+				d.Login, d.Current, d.LedgerCurrent, d.Withdrawn, d.LedgerWithdrawn)
+		}
+	}
+}
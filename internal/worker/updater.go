@@ -2,44 +2,174 @@ package worker
 
 import (
 	"context"
-	"database/sql"
 	"errors"
-	"log"
+	"sync"
 	"time"
 
+	"github.com/IgorAleksandroff/gophermart/internal/entity"
 	"github.com/IgorAleksandroff/gophermart/internal/usecase"
+	"github.com/IgorAleksandroff/gophermart/internal/webapi"
 	"github.com/IgorAleksandroff/gophermart/pkg/logger"
 )
 
-const updatePeriod = 100 * time.Millisecond
+const (
+	updatePeriod = 100 * time.Millisecond
+	// pollTimeout bounds one poll, in-flight polls are finished with it on shutdown.
+	pollTimeout = 30 * time.Second
+)
 
 type Updater struct {
-	period   time.Duration
-	statuses usecase.UpdaterStatuses
-	ctx      context.Context
-	l        *logger.Logger
+	period    time.Duration
+	poolSize  int
+	batchSize int
+	statuses  usecase.UpdaterStatuses
+	l         *logger.Logger
+
+	mu          sync.Mutex
+	pausedUntil time.Time
 }
 
-func NewUpdater(ctx context.Context, statusesUsecase usecase.UpdaterStatuses, l *logger.Logger) *Updater {
+func NewUpdater(
+	statusesUsecase usecase.UpdaterStatuses,
+	poolSize, batchSize int,
+	l *logger.Logger,
+) *Updater {
+	if poolSize <= 0 {
+		poolSize = 1
+	}
+	if batchSize <= 0 {
+		batchSize = poolSize
+	}
+
 	return &Updater{
-		period:   updatePeriod,
-		statuses: statusesUsecase,
-		ctx:      ctx,
-		l:        l,
+		period:    updatePeriod,
+		poolSize:  poolSize,
+		batchSize: batchSize,
+		statuses:  statusesUsecase,
+		l:         l,
 	}
 }
 
-func (u *Updater) Run() {
+// Run claims batches of pending orders and hands them to a pool of pollers until ctx is cancelled.
+// On cancel it stops claiming new orders and returns after the in-flight polls are finished.
+func (u *Updater) Run(ctx context.Context) error {
+	orders := make(chan entity.Order)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < u.poolSize; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u.poll(ctx, orders)
+		}()
+	}
+
+	defer func() {
+		close(orders)
+		wg.Wait()
+	}()
+
 	ticker := time.NewTicker(u.period)
 	defer ticker.Stop()
 
 	for {
-		<-ticker.C
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if u.paused() {
+			continue
+		}
+
+		batch, err := u.statuses.GetOrdersForUpdate(ctx, u.batchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				u.l.Warn("can't get orders for update, %s", err.Error())
+			}
+			continue
+		}
+
+		// orders left undispatched on shutdown are released when their claim expires
+		for _, order := range batch {
+			select {
+			case orders <- order:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// poll doesn't wait out a rate limit pause with the orders it has got: they're claimed only for the lease,
+// so it hands them back until the pause ends, and another replica doesn't poll them meanwhile.
+func (u *Updater) poll(ctx context.Context, orders <-chan entity.Order) {
+	for order := range orders {
+		// orders left on shutdown are released when their claim expires
+		if ctx.Err() != nil {
+			continue
+		}
+
+		if pausedUntil := u.pauseEnd(); time.Now().Before(pausedUntil) {
+			u.postpone(order, pausedUntil, "polling is paused by the accrual rate limit")
+			continue
+		}
+
+		err := u.updateStatus(order)
+
+		var rateLimitErr *webapi.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			u.postpone(order, u.pause(rateLimitErr), rateLimitErr.Error())
+			continue
+		}
 
-		log.Println("worker: start")
-		err := u.statuses.UpdateStatus(u.ctx)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			u.l.Warn("can't update metrics, %s", err.Error())
+		if err != nil {
+			u.l.Warn("can't update order %s, %s", order.OrderID, err.Error())
 		}
 	}
 }
+
+// updateStatus isn't bound to the Run context, so a poll that has started is finished on shutdown.
+func (u *Updater) updateStatus(order entity.Order) error {
+	ctx, cancel := context.WithTimeout(context.Background(), pollTimeout)
+	defer cancel()
+
+	return u.statuses.UpdateStatus(ctx, order)
+}
+
+func (u *Updater) postpone(order entity.Order, until time.Time, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), pollTimeout)
+	defer cancel()
+
+	if err := u.statuses.Postpone(ctx, order, until, reason); err != nil {
+		u.l.Warn("can't postpone order %s, %s", order.OrderID, err.Error())
+	}
+}
+
+// pause stops polling of all pollers: the accrual system limits requests of the whole service.
+// It returns the end of the pause.
+func (u *Updater) pause(rateLimitErr *webapi.RateLimitError) time.Time {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	pausedUntil := time.Now().Add(rateLimitErr.RetryAfter)
+	if pausedUntil.After(u.pausedUntil) {
+		u.pausedUntil = pausedUntil
+		u.l.Warn("accrual rate limit, pause polling until %s: %s",
+			pausedUntil.Format(time.RFC3339), rateLimitErr.Error())
+	}
+
+	return u.pausedUntil
+}
+
+func (u *Updater) paused() bool {
+	return time.Now().Before(u.pauseEnd())
+}
+
+func (u *Updater) pauseEnd() time.Time {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.pausedUntil
+}
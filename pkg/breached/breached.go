@@ -0,0 +1,52 @@
+package breached
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+)
+
+//go:embed passwords.txt
+var bundled string
+
+// List is a set of leaked passwords which mustn't be used.
+type List struct {
+	passwords map[string]struct{}
+}
+
+// Bundled returns the list of the most common leaked passwords shipped with the service.
+func Bundled() *List {
+	return parse(bundled)
+}
+
+// Load reads the list from a file of one password per line, lines starting with # are skipped.
+func Load(path string) (*List, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error to read breached passwords file: %w", err)
+	}
+
+	return parse(string(content)), nil
+}
+
+func (l *List) Contains(password string) bool {
+	_, ok := l.passwords[strings.ToLower(password)]
+	return ok
+}
+
+func parse(content string) *List {
+	l := &List{passwords: make(map[string]struct{})}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		l.passwords[strings.ToLower(line)] = struct{}{}
+	}
+
+	return l
+}
@@ -0,0 +1,66 @@
+package breached
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContains(t *testing.T) {
+	l := parse("# comment\n\nPassword\n  qwerty  \n#hidden\n")
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{password: "password", want: true},
+		{password: "PASSWORD", want: true},
+		{password: "qwerty", want: true},
+		{password: "  qwerty  ", want: false},
+		{password: "# comment", want: false},
+		{password: "#hidden", want: false},
+		{password: "", want: false},
+		{password: "correct horse", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := l.Contains(tt.password); got != tt.want {
+			t.Errorf("Contains(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestBundled(t *testing.T) {
+	l := Bundled()
+
+	for _, password := range []string{"123456", "password", "QWERTY"} {
+		if !l.Contains(password) {
+			t.Errorf("bundled list doesn't contain %q", password)
+		}
+	}
+	if l.Contains("correct horse battery staple") {
+		t.Error("bundled list contains a strong password")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passwords.txt")
+	if err := os.WriteFile(path, []byte("# leaked\r\nhunter2\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !l.Contains("Hunter2") {
+		t.Error("loaded list doesn't contain hunter2")
+	}
+	if l.Contains("123456") {
+		t.Error("loaded list contains a bundled password")
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("Load of a missing file returned no error")
+	}
+}
@@ -0,0 +1,68 @@
+package hasher
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Algorithm is one password hashing scheme with a self-describing stored format.
+type Algorithm interface {
+	Hash(password string) (string, error)
+	Compare(hash, password string) (bool, error)
+	// Identify reports whether the hash was produced by this algorithm.
+	Identify(hash string) bool
+	// Outdated reports whether the hash was produced with weaker parameters than configured.
+	Outdated(hash string) bool
+}
+
+// Hasher hashes new passwords with the primary algorithm and verifies hashes of any known algorithm.
+type Hasher struct {
+	primary Algorithm
+	known   []Algorithm
+}
+
+// New returns a Hasher for the configured algorithm. It verifies hashes of both bcrypt and argon2id
+// and of the given fallback algorithms, so stored hashes can be upgraded on the next login.
+func New(algorithm string, fallbacks ...Algorithm) (*Hasher, error) {
+	bcryptAlgorithm := NewBcrypt(DefaultBcryptCost)
+	argon2idAlgorithm := NewArgon2id(DefaultArgon2idParams)
+
+	var known []Algorithm
+	switch strings.ToLower(algorithm) {
+	case AlgorithmBcrypt:
+		known = []Algorithm{bcryptAlgorithm, argon2idAlgorithm}
+	case AlgorithmArgon2id:
+		known = []Algorithm{argon2idAlgorithm, bcryptAlgorithm}
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", algorithm)
+	}
+
+	return &Hasher{primary: known[0], known: append(known, fallbacks...)}, nil
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.primary.Hash(password)
+}
+
+func (h *Hasher) Compare(hash, password string) (bool, error) {
+	for _, a := range h.known {
+		if a.Identify(hash) {
+			return a.Compare(hash, password)
+		}
+	}
+
+	return false, ErrUnknownHash
+}
+
+// NeedsRehash reports whether the hash should be replaced with a hash of the primary algorithm.
+func (h *Hasher) NeedsRehash(hash string) bool {
+	return !h.primary.Identify(hash) || h.primary.Outdated(hash)
+}
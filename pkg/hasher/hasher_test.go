@@ -0,0 +1,233 @@
+package hasher
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// legacySalt and legacySecretHash are the salt of the first releases and the hash of "secret"
+	// they stored: hex of the salt followed by SHA-1 of the password.
+	legacySalt       = "hjjrhjqw134617ajfhajs"
+	legacySecretHash = "686a6a72686a7177313334363137616a6668616a73e5e9fa1ba31ecd1ae84f75caaa474f3a663f05f4"
+)
+
+// testArgon2idParams keep the tests fast, the defaults take tens of megabytes per hash.
+var testArgon2idParams = Argon2idParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestAlgorithmRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm Algorithm
+	}{
+		{name: "bcrypt", algorithm: NewBcrypt(bcrypt.MinCost)},
+		{name: "argon2id", algorithm: NewArgon2id(testArgon2idParams)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := tt.algorithm.Hash("secret")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if !tt.algorithm.Identify(hash) {
+				t.Errorf("Identify(%q) = false", hash)
+			}
+
+			ok, err := tt.algorithm.Compare(hash, "secret")
+			if err != nil || !ok {
+				t.Errorf("Compare with the password = %v, %v, want true", ok, err)
+			}
+			ok, err = tt.algorithm.Compare(hash, "Secret")
+			if err != nil || ok {
+				t.Errorf("Compare with another password = %v, %v, want false", ok, err)
+			}
+
+			other, err := tt.algorithm.Hash("secret")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if other == hash {
+				t.Error("two hashes of the same password are equal, the salt isn't random")
+			}
+		})
+	}
+}
+
+func TestArgon2idCompareMalformed(t *testing.T) {
+	a := NewArgon2id(testArgon2idParams)
+
+	for _, hash := range []string{
+		"$argon2id$",
+		"$argon2id$v=18$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5",
+	} {
+		if _, err := a.Compare(hash, "secret"); err == nil {
+			t.Errorf("Compare(%q) returned no error", hash)
+		}
+	}
+}
+
+func TestLegacySHA1(t *testing.T) {
+	legacy := NewLegacySHA1(legacySalt)
+
+	hash, err := legacy.Hash("secret")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if hash != legacySecretHash {
+		t.Errorf("Hash = %q, want the baseline hash %q", hash, legacySecretHash)
+	}
+
+	h, err := New(AlgorithmBcrypt, legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := h.Compare(legacySecretHash, "secret")
+	if err != nil || !ok {
+		t.Errorf("Compare with the password = %v, %v, want true", ok, err)
+	}
+	ok, err = h.Compare(legacySecretHash, "Secret")
+	if err != nil || ok {
+		t.Errorf("Compare with another password = %v, %v, want false", ok, err)
+	}
+	if !h.NeedsRehash(legacySecretHash) {
+		t.Error("NeedsRehash of a legacy hash = false")
+	}
+}
+
+func TestCompareUnknownHash(t *testing.T) {
+	h, err := New(AlgorithmArgon2id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hash := range []string{legacySecretHash, "$scrypt$whatever"} {
+		if _, err := h.Compare(hash, "secret"); !errors.Is(err, ErrUnknownHash) {
+			t.Errorf("Compare(%q) error = %v, want ErrUnknownHash", hash, err)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		prefix    string
+		wantErr   bool
+	}{
+		{algorithm: "bcrypt", prefix: "$2a$"},
+		{algorithm: "BCRYPT", prefix: "$2a$"},
+		{algorithm: "argon2id", prefix: argon2idPrefix},
+		{algorithm: "sha1", wantErr: true},
+		{algorithm: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			h, err := New(tt.algorithm)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New(%q) error = %v, want error %v", tt.algorithm, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			// the default parameters are slow, only the primary algorithm is checked
+			if !h.primary.Identify(tt.prefix) {
+				t.Errorf("New(%q) primary algorithm doesn't identify %q", tt.algorithm, tt.prefix)
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	hash := func(a Algorithm) string {
+		t.Helper()
+		h, err := a.Hash("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	withArgon2id := func(change func(p *Argon2idParams)) string {
+		params := testArgon2idParams
+		change(&params)
+		return hash(NewArgon2id(params))
+	}
+
+	bcryptPrimary := &Hasher{primary: NewBcrypt(bcrypt.MinCost + 1)}
+	argon2idPrimary := &Hasher{primary: NewArgon2id(testArgon2idParams)}
+
+	tests := []struct {
+		name   string
+		hasher *Hasher
+		hash   string
+		want   bool
+	}{
+		{name: "bcrypt same cost", hasher: bcryptPrimary, hash: hash(NewBcrypt(bcrypt.MinCost + 1)), want: false},
+		{name: "bcrypt higher cost", hasher: bcryptPrimary, hash: hash(NewBcrypt(bcrypt.MinCost + 2)), want: false},
+		{name: "bcrypt lower cost", hasher: bcryptPrimary, hash: hash(NewBcrypt(bcrypt.MinCost)), want: true},
+		{name: "bcrypt malformed", hasher: bcryptPrimary, hash: "$2a$xx", want: true},
+		{name: "argon2id under bcrypt", hasher: bcryptPrimary, hash: hash(NewArgon2id(testArgon2idParams)), want: true},
+		{name: "legacy under bcrypt", hasher: bcryptPrimary, hash: legacySecretHash, want: true},
+
+		{name: "argon2id same params", hasher: argon2idPrimary, hash: hash(NewArgon2id(testArgon2idParams)), want: false},
+		{name: "argon2id more memory", hasher: argon2idPrimary,
+			hash: withArgon2id(func(p *Argon2idParams) { p.Memory *= 2 }), want: false},
+		{name: "argon2id less memory", hasher: argon2idPrimary,
+			hash: withArgon2id(func(p *Argon2idParams) { p.Memory /= 2 }), want: true},
+		{name: "argon2id more iterations", hasher: argon2idPrimary,
+			hash: withArgon2id(func(p *Argon2idParams) { p.Iterations = 2 }), want: false},
+		{name: "argon2id shorter key", hasher: argon2idPrimary,
+			hash: withArgon2id(func(p *Argon2idParams) { p.KeyLength = 16 }), want: true},
+		{name: "argon2id malformed", hasher: argon2idPrimary, hash: argon2idPrefix + "v=19", want: true},
+		{name: "bcrypt under argon2id", hasher: argon2idPrimary, hash: hash(NewBcrypt(bcrypt.MinCost)), want: true},
+		{name: "legacy under argon2id", hasher: argon2idPrimary, hash: legacySecretHash, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hasher.NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash(%q) = %v, want %v", tt.hash, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestNeedsRehashArgon2idCost raises the configured iterations and parallelism over the stored ones.
+func TestNeedsRehashArgon2idCost(t *testing.T) {
+	stored, err := NewArgon2id(testArgon2idParams).Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(p *Argon2idParams)
+	}{
+		{name: "more iterations", change: func(p *Argon2idParams) { p.Iterations = 2 }},
+		{name: "more parallelism", change: func(p *Argon2idParams) { p.Parallelism = 2 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := testArgon2idParams
+			tt.change(&params)
+			h := &Hasher{primary: NewArgon2id(params)}
+
+			if !h.NeedsRehash(stored) {
+				t.Errorf("NeedsRehash(%q) = false", stored)
+			}
+		})
+	}
+}
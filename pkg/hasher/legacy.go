@@ -0,0 +1,43 @@
+package hasher
+
+import (
+	"crypto/sha1"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+)
+
+type legacySHA1 struct {
+	salt string
+}
+
+// NewLegacySHA1 verifies hashes of the first gophermart releases: hex of the salt followed by SHA-1 of the password.
+// It's meant only as a fallback to upgrade such hashes, new passwords must not be hashed with it.
+func NewLegacySHA1(salt string) Algorithm {
+	return &legacySHA1{salt: salt}
+}
+
+func (l *legacySHA1) Hash(password string) (string, error) {
+	hash := sha1.New()
+	hash.Write([]byte(password))
+
+	// Sum appends the digest to the salt instead of hashing it, kept as is to match the stored hashes.
+	return fmt.Sprintf("%x", hash.Sum([]byte(l.salt))), nil
+}
+
+func (l *legacySHA1) Compare(hash, password string) (bool, error) {
+	otherHash, err := l.Hash(password)
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(otherHash)) == 1, nil
+}
+
+func (l *legacySHA1) Identify(hash string) bool {
+	return !strings.HasPrefix(hash, "$")
+}
+
+func (l *legacySHA1) Outdated(hash string) bool {
+	return true
+}
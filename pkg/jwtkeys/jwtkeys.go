@@ -0,0 +1,261 @@
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+
+	minSecretLength = 32
+)
+
+var (
+	ErrUnknownKey    = errors.New("unknown token key id")
+	ErrInvalidMethod = errors.New("invalid signing method")
+)
+
+// Key is a signing key, or a verification-only key of a retired signer when Sign is nil.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	Sign   interface{}
+	Verify interface{}
+}
+
+// KeySet signs tokens with the active key and verifies them with any key of the set found by the "kid" header,
+// so a key can be rotated by adding a new active key while the previous one is still accepted.
+type KeySet struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+// File is the format of the keys file:
+//
+//	{
+//	  "active": "2022-11",
+//	  "keys": [
+//	    {"kid": "2022-10", "alg": "HS256", "secret": "..."},
+//	    {"kid": "2022-11", "alg": "RS256", "private_key_file": "/etc/gophermart/jwt-2022-11.pem"},
+//	    {"kid": "2022-09", "alg": "EdDSA", "public_key_file": "/etc/gophermart/jwt-2022-09.pub"}
+//	  ]
+//	}
+type File struct {
+	Active string    `json:"active"`
+	Keys   []FileKey `json:"keys"`
+}
+
+type FileKey struct {
+	ID             string `json:"kid"`
+	Alg            string `json:"alg"`
+	Secret         string `json:"secret,omitempty"`
+	PrivateKeyFile string `json:"private_key_file,omitempty"`
+	PublicKeyFile  string `json:"public_key_file,omitempty"`
+}
+
+func New(active string, keys ...*Key) (*KeySet, error) {
+	ks := &KeySet{keys: make(map[string]*Key, len(keys))}
+	for _, k := range keys {
+		if k.ID == "" {
+			return nil, errors.New("token key without kid")
+		}
+		if _, ok := ks.keys[k.ID]; ok {
+			return nil, fmt.Errorf("duplicated token key id %q", k.ID)
+		}
+		ks.keys[k.ID] = k
+	}
+
+	activeKey, ok := ks.keys[active]
+	if !ok {
+		return nil, fmt.Errorf("active token key %q: %w", active, ErrUnknownKey)
+	}
+	if activeKey.Sign == nil {
+		return nil, fmt.Errorf("active token key %q has no private key", active)
+	}
+	ks.active = activeKey
+
+	return ks, nil
+}
+
+// FromSecret returns a key set of a single HS256 key.
+func FromSecret(id, secret string) (*KeySet, error) {
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("token secret must be at least %d bytes", minSecretLength)
+	}
+
+	return New(id, &Key{ID: id, Method: jwt.SigningMethodHS256, Sign: []byte(secret), Verify: []byte(secret)})
+}
+
+// Ephemeral returns a key set of a random HS256 key, tokens signed with it don't survive a restart.
+func Ephemeral() (*KeySet, error) {
+	secret := make([]byte, minSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return FromSecret("ephemeral", string(secret))
+}
+
+// Load reads the key set from the keys file, see File.
+func Load(path string) (*KeySet, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error to read token keys file: %w", err)
+	}
+
+	var file File
+	if err = json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("error to parse token keys file: %w", err)
+	}
+
+	keys := make([]*Key, 0, len(file.Keys))
+	for _, fk := range file.Keys {
+		k, err := parseKey(fk)
+		if err != nil {
+			return nil, fmt.Errorf("token key %q: %w", fk.ID, err)
+		}
+		keys = append(keys, k)
+	}
+
+	return New(file.Active, keys...)
+}
+
+// Sign signs the claims with the active key and sets its id as the "kid" header.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+
+	return token.SignedString(ks.active.Sign)
+}
+
+// Keyfunc finds the verification key by the "kid" header, the token algorithm must match the key one.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	id, _ := token.Header["kid"].(string)
+
+	k, ok := ks.keys[id]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != k.Method.Alg() {
+		return nil, ErrInvalidMethod
+	}
+
+	return k.Verify, nil
+}
+
+// JWK is a public key in the JSON Web Key format.
+type JWK struct {
+	KeyType string `json:"kty"`
+	ID      string `json:"kid"`
+	Alg     string `json:"alg"`
+	Use     string `json:"use"`
+	N       string `json:"n,omitempty"`
+	E       string `json:"e,omitempty"`
+	Curve   string `json:"crv,omitempty"`
+	X       string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys of the set, so other services can verify tokens without the signing secret.
+// HMAC keys are secret and never included.
+func (ks *KeySet) JWKS() []JWK {
+	result := make([]JWK, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		switch key := k.Verify.(type) {
+		case *rsa.PublicKey:
+			result = append(result, JWK{
+				KeyType: "RSA",
+				ID:      k.ID,
+				Alg:     k.Method.Alg(),
+				Use:     "sig",
+				N:       base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			result = append(result, JWK{
+				KeyType: "OKP",
+				ID:      k.ID,
+				Alg:     k.Method.Alg(),
+				Use:     "sig",
+				Curve:   "Ed25519",
+				X:       base64.RawURLEncoding.EncodeToString(key),
+			})
+		}
+	}
+
+	return result
+}
+
+func parseKey(fk FileKey) (*Key, error) {
+	k := &Key{ID: fk.ID}
+
+	switch fk.Alg {
+	case AlgHS256:
+		if len(fk.Secret) < minSecretLength {
+			return nil, fmt.Errorf("secret must be at least %d bytes", minSecretLength)
+		}
+		k.Method, k.Sign, k.Verify = jwt.SigningMethodHS256, []byte(fk.Secret), []byte(fk.Secret)
+	case AlgRS256:
+		k.Method = jwt.SigningMethodRS256
+		if fk.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(fk.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			k.Sign, k.Verify = privateKey, &privateKey.PublicKey
+		} else {
+			pem, err := os.ReadFile(fk.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			if k.Verify, err = jwt.ParseRSAPublicKeyFromPEM(pem); err != nil {
+				return nil, err
+			}
+		}
+	case AlgEdDSA:
+		k.Method = jwt.SigningMethodEdDSA
+		if fk.PrivateKeyFile != "" {
+			pem, err := os.ReadFile(fk.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			privateKey, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, err
+			}
+			signer, ok := privateKey.(crypto.Signer)
+			if !ok {
+				return nil, errors.New("ed25519 private key is not a signer")
+			}
+			k.Sign, k.Verify = signer, signer.Public()
+		} else {
+			pem, err := os.ReadFile(fk.PublicKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			if k.Verify, err = jwt.ParseEdPublicKeyFromPEM(pem); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", fk.Alg)
+	}
+
+	return k, nil
+}
@@ -0,0 +1,381 @@
+package jwtkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+type testKeys struct {
+	hs256 *Key
+	rs256 *Key
+	eddsa *Key
+
+	rsaKey     *rsa.PrivateKey
+	ed25519Key ed25519.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testKeys{
+		hs256: &Key{ID: "hs", Method: jwt.SigningMethodHS256, Sign: []byte(testSecret), Verify: []byte(testSecret)},
+		rs256: &Key{ID: "rs", Method: jwt.SigningMethodRS256, Sign: rsaKey, Verify: &rsaKey.PublicKey},
+		eddsa: &Key{ID: "ed", Method: jwt.SigningMethodEdDSA, Sign: edPrivate, Verify: edPublic},
+
+		rsaKey:     rsaKey,
+		ed25519Key: edPrivate,
+	}
+}
+
+func testClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Subject:   "user",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+}
+
+func parse(ks *KeySet, token string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, ks.Keyfunc)
+
+	return claims, err
+}
+
+func TestSignAndVerify(t *testing.T) {
+	keys := newTestKeys(t)
+
+	for _, k := range []*Key{keys.hs256, keys.rs256, keys.eddsa} {
+		t.Run(k.Method.Alg(), func(t *testing.T) {
+			ks, err := New(k.ID, k)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := ks.Sign(testClaims())
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+
+			parsed, _, err := new(jwt.Parser).ParseUnverified(token, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != k.ID || parsed.Header["alg"] != k.Method.Alg() {
+				t.Errorf("header = %v, want kid %q and alg %q", parsed.Header, k.ID, k.Method.Alg())
+			}
+
+			claims, err := parse(ks, token)
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if claims.Subject != "user" {
+				t.Errorf("subject = %q, want user", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestKeyfuncChoosesKeyByKid(t *testing.T) {
+	keys := newTestKeys(t)
+
+	// the RS256 key is retired: it only verifies tokens issued before the rotation to EdDSA
+	retired := &Key{ID: keys.rs256.ID, Method: keys.rs256.Method, Verify: keys.rs256.Verify}
+	rotated, err := New(keys.eddsa.ID, retired, keys.eddsa, keys.hs256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range []*Key{keys.hs256, keys.rs256, keys.eddsa} {
+		signer, err := New(k.ID, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := signer.Sign(testClaims())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := parse(rotated, token); err != nil {
+			t.Errorf("token of key %q isn't verified by the rotated set: %v", k.ID, err)
+		}
+	}
+
+	token, err := rotated.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header["kid"] != keys.eddsa.ID {
+		t.Errorf("rotated set signs with kid %v, want the active %q", parsed.Header["kid"], keys.eddsa.ID)
+	}
+}
+
+func TestKeyfuncRejectsUnknownKid(t *testing.T) {
+	keys := newTestKeys(t)
+
+	ks, err := New(keys.hs256.ID, keys.hs256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, kid := range map[string]interface{}{"unknown": "other", "missing": nil, "not a string": 1} {
+		t.Run(name, func(t *testing.T) {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+			if kid != nil {
+				token.Header["kid"] = kid
+			}
+			signed, err := token.SignedString([]byte(testSecret))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := parse(ks, signed); !errors.Is(err, ErrUnknownKey) {
+				t.Errorf("verify error = %v, want ErrUnknownKey", err)
+			}
+		})
+	}
+}
+
+func TestKeyfuncRejectsAlgMismatch(t *testing.T) {
+	keys := newTestKeys(t)
+
+	ks, err := New(keys.rs256.ID, keys.rs256, keys.hs256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&keys.rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	tests := []struct {
+		name   string
+		kid    string
+		method jwt.SigningMethod
+		key    interface{}
+	}{
+		// the classic confusion: HS256 keyed with the public key the verifier would use for RS256
+		{name: "HS256 with the RS256 kid", kid: keys.rs256.ID, method: jwt.SigningMethodHS256, key: publicPEM},
+		{name: "RS256 with the HS256 kid", kid: keys.hs256.ID, method: jwt.SigningMethodRS256, key: keys.rsaKey},
+		{name: "EdDSA with the RS256 kid", kid: keys.rs256.ID, method: jwt.SigningMethodEdDSA, key: keys.ed25519Key},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := jwt.NewWithClaims(tt.method, testClaims())
+			token.Header["kid"] = tt.kid
+			signed, err := token.SignedString(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := parse(ks, signed); !errors.Is(err, ErrInvalidMethod) {
+				t.Errorf("verify error = %v, want ErrInvalidMethod", err)
+			}
+		})
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	keys := newTestKeys(t)
+	verifyOnly := &Key{ID: "verify", Method: jwt.SigningMethodRS256, Verify: &keys.rsaKey.PublicKey}
+
+	tests := []struct {
+		name   string
+		active string
+		keys   []*Key
+	}{
+		{name: "unknown active", active: "other", keys: []*Key{keys.hs256}},
+		{name: "active without private key", active: verifyOnly.ID, keys: []*Key{verifyOnly}},
+		{name: "duplicated kid", active: keys.hs256.ID, keys: []*Key{keys.hs256, keys.hs256}},
+		{name: "empty kid", active: "", keys: []*Key{{Method: jwt.SigningMethodHS256, Sign: []byte(testSecret)}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.active, tt.keys...); err == nil {
+				t.Error("New returned no error")
+			}
+		})
+	}
+
+	if _, err := FromSecret("short", "secret"); err == nil {
+		t.Error("FromSecret accepted a short secret")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+
+	ks, err := New(keys.hs256.ID, keys.hs256, keys.rs256, keys.eddsa)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := make(map[string]JWK)
+	for _, jwk := range ks.JWKS() {
+		jwks[jwk.ID] = jwk
+	}
+
+	if _, ok := jwks[keys.hs256.ID]; ok {
+		t.Error("JWKS includes the HMAC secret")
+	}
+	if len(jwks) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", len(jwks))
+	}
+
+	rsaJWK := jwks[keys.rs256.ID]
+	if rsaJWK.KeyType != "RSA" || rsaJWK.Alg != AlgRS256 || rsaJWK.Use != "sig" {
+		t.Errorf("RSA JWK = %+v", rsaJWK)
+	}
+	if n := decodeBigInt(t, rsaJWK.N); n.Cmp(keys.rsaKey.N) != 0 {
+		t.Error("RSA JWK modulus doesn't match the key")
+	}
+	if e := decodeBigInt(t, rsaJWK.E); e.Int64() != int64(keys.rsaKey.E) {
+		t.Errorf("RSA JWK exponent = %d, want %d", e.Int64(), keys.rsaKey.E)
+	}
+
+	edJWK := jwks[keys.eddsa.ID]
+	if edJWK.KeyType != "OKP" || edJWK.Curve != "Ed25519" || edJWK.Alg != AlgEdDSA || edJWK.Use != "sig" {
+		t.Errorf("EdDSA JWK = %+v", edJWK)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(edJWK.X)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed25519.PublicKey(x).Equal(keys.eddsa.Verify) {
+		t.Error("EdDSA JWK x doesn't match the key")
+	}
+
+	content, err := json.Marshal(ks.JWKS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), testSecret) {
+		t.Error("JWKS JSON includes the HMAC secret")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	keys := newTestKeys(t)
+	dir := t.TempDir()
+
+	rsaDER, err := x509.MarshalPKCS8PrivateKey(keys.rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublicDER, err := x509.MarshalPKIXPublicKey(keys.ed25519Key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaFile := writeFile(t, dir, "rs.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rsaDER}))
+	edFile := writeFile(t, dir, "ed.pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: edPublicDER}))
+
+	file := File{
+		Active: "rs",
+		Keys: []FileKey{
+			{ID: "hs", Alg: AlgHS256, Secret: testSecret},
+			{ID: "rs", Alg: AlgRS256, PrivateKeyFile: rsaFile},
+			{ID: "ed", Alg: AlgEdDSA, PublicKeyFile: edFile},
+		},
+	}
+	ks, err := Load(writeJSON(t, dir, "keys.json", file))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	token, err := ks.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parse(ks, token); err != nil {
+		t.Errorf("verify a token of the loaded active key: %v", err)
+	}
+
+	edSigner, err := New(keys.eddsa.ID, keys.eddsa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edToken, err := edSigner.Sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parse(ks, edToken); err != nil {
+		t.Errorf("verify a token of the loaded verification-only key: %v", err)
+	}
+
+	bad := []FileKey{
+		{ID: "hs", Alg: AlgHS256, Secret: "short"},
+		{ID: "x", Alg: "HS512", Secret: testSecret},
+		{ID: "rs", Alg: AlgRS256, PrivateKeyFile: filepath.Join(dir, "missing.pem")},
+	}
+	for _, fk := range bad {
+		path := writeJSON(t, dir, "bad.json", File{Active: fk.ID, Keys: []FileKey{fk}})
+		if _, err := Load(path); err == nil {
+			t.Errorf("Load accepted %+v", fk)
+		}
+	}
+}
+
+func decodeBigInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return new(big.Int).SetBytes(b)
+}
+
+func writeFile(t *testing.T, dir, name string, content []byte) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func writeJSON(t *testing.T, dir, name string, v interface{}) string {
+	t.Helper()
+
+	content, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return writeFile(t, dir, name, content)
+}